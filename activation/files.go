@@ -18,6 +18,7 @@ package activation
 import (
 	"os"
 	"strconv"
+	"strings"
 	"syscall"
 )
 
@@ -26,10 +27,42 @@ const (
 	listenFdsStart = 3
 )
 
+// Files returns a slice containing a `os.File` object for each
+// file descriptor passed to this process via systemd fd-passing protocol.
+//
+// The files are named after the socket names passed in LISTEN_FDNAMES, as set
+// with FileDescriptorName= in the socket unit, or LISTEN_FD_<fd> if none is
+// available. Files used to be named LISTEN_FD_<fd> in all cases, so callers
+// relying on f.Name() should expect socket names as well. If unsetEnv is true,
+// the LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES environment variables are
+// unset.
+//
+// The file descriptors are marked close-on-exec, so they are not leaked to
+// child processes; see FilesInheritable otherwise.
 func Files(unsetEnv bool) []*os.File {
+	return files(unsetEnv, true)
+}
+
+// FilesInheritable works like Files, but clears the close-on-exec flag of the
+// file descriptors instead of setting it, so that they are kept across exec.
+// File descriptors whose flag cannot be cleared, e.g. as they are not valid,
+// are left out.
+//
+// This is meant for graceful restarts re-executing the binary in place with
+// syscall.Exec: as the process ID does not change, LISTEN_PID remains valid,
+// and the new image finds the sockets with Files as long as unsetEnv was false.
+// A child process started with os/exec gets a different process ID, for which
+// LISTEN_PID cannot be set beforehand, and should rather be given the files
+// through exec.Cmd.ExtraFiles, which are always inherited.
+func FilesInheritable(unsetEnv bool) []*os.File {
+	return files(unsetEnv, false)
+}
+
+func files(unsetEnv bool, closeOnExec bool) []*os.File {
 	if unsetEnv {
 		defer os.Unsetenv("LISTEN_PID")
 		defer os.Unsetenv("LISTEN_FDS")
+		defer os.Unsetenv("LISTEN_FDNAMES")
 	}
 
 	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
@@ -42,10 +75,22 @@ func Files(unsetEnv bool) []*os.File {
 		return nil
 	}
 
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
 	files := make([]*os.File, 0, nfds)
 	for fd := listenFdsStart; fd < listenFdsStart+nfds; fd++ {
-		syscall.CloseOnExec(fd)
-		files = append(files, os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd)))
+		if closeOnExec {
+			syscall.CloseOnExec(fd)
+		} else if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_SETFD, 0); errno != 0 {
+			// Not a valid file descriptor, or it would not be
+			// inherited as asked
+			continue
+		}
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i := fd - listenFdsStart; i < len(names) && len(names[i]) > 0 {
+			name = names[i]
+		}
+		files = append(files, os.NewFile(uintptr(fd), name))
 	}
 
 	return files
@@ -37,9 +37,31 @@ func Listeners(unsetEnv bool) ([]net.Listener, error) {
 	return listeners, nil
 }
 
+// ListenersWithNames maps the names of the sockets passed to this process, as
+// set with FileDescriptorName= and passed in LISTEN_FDNAMES, to a net.Listener
+// for each of them, in the order of their file descriptors. Sockets that are
+// not listeners are left out. Sockets without a name are found under
+// LISTEN_FD_<fd>. The names are those of the files returned by Files.
+func ListenersWithNames(unsetEnv bool) (map[string][]net.Listener, error) {
+	files := Files(unsetEnv)
+	listeners := map[string][]net.Listener{}
+
+	for _, f := range files {
+		if l, err := net.FileListener(f); err == nil {
+			listeners[f.Name()] = append(listeners[f.Name()], l)
+		}
+	}
+	return listeners, nil
+}
+
 // TLSListeners returns a slice containing a net.listener for each matching TCP socket type
 // passed to this process.
 // It uses default Listeners func and forces TCP sockets handlers to use TLS based on tlsConfig.
+//
+// As with Listeners, the order of the file descriptors is preserved, so that
+// sockets can still be told apart, and nil values fill the gaps. tlsConfig is
+// used as is and not modified: set its NextProtos to advertise protocols such
+// as http/1.1.
 func TLSListeners(unsetEnv bool, tlsConfig *tls.Config) ([]net.Listener, error) {
 	listeners, err := Listeners(unsetEnv)
 
@@ -47,12 +69,10 @@ func TLSListeners(unsetEnv bool, tlsConfig *tls.Config) ([]net.Listener, error)
 		return nil, err
 	}
 
-	if tlsConfig != nil && err == nil {
-		tlsConfig.NextProtos = []string{"http/1.1"}
-
+	if tlsConfig != nil {
 		for i, l := range listeners {
 			// Activate TLS only for TCP sockets
-			if l.Addr().Network() == "tcp" {
+			if l != nil && l.Addr().Network() == "tcp" {
 				listeners[i] = tls.NewListener(l, tlsConfig)
 			}
 		}
@@ -84,3 +84,85 @@ func TestListeners(t *testing.T) {
 	correctStringWrittenNet(t, r1, "Hello world")
 	correctStringWrittenNet(t, r2, "Goodbye world")
 }
+
+// TestTLSListeners forks out a copy of the tlslisten.go example, which checks
+// that the UDP socket passed first is left as a nil gap before the TCP
+// listener.
+func TestTLSListeners(t *testing.T) {
+	cmd := exec.Command("go", "run", "../examples/activation/tlslisten.go")
+
+	u, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer u.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	f1, err := u.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd.ExtraFiles = []*os.File{
+		f1,
+		f2,
+	}
+
+	cmd.Env = os.Environ()
+	cmd.Env = append(cmd.Env, "LISTEN_FDS=2", "FIX_LISTEN_PID=1")
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Cmd output '%s', err: '%s'\n", out, err)
+	}
+}
+
+// TestListenersWithNames forks out a copy of the listennames.go example, which
+// writes back the name and index under which it found each listener.
+func TestListenersWithNames(t *testing.T) {
+	cmd := exec.Command("go", "run", "../examples/activation/listennames.go")
+
+	var files []*os.File
+	var conns []net.Conn
+	for i := 0; i < 3; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		f, err := l.(*net.TCPListener).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		conns = append(conns, c)
+	}
+	cmd.ExtraFiles = files
+
+	// The second socket has no name, and falls back to its file descriptor
+	cmd.Env = os.Environ()
+	cmd.Env = append(cmd.Env, "LISTEN_FDS=3", "LISTEN_FDNAMES=web::web", "FIX_LISTEN_PID=1")
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Cmd output '%s', err: '%s'\n", out, err)
+	}
+
+	correctStringWrittenNet(t, conns[0], "web 0")
+	correctStringWrittenNet(t, conns[1], "LISTEN_FD_4 0")
+	correctStringWrittenNet(t, conns[2], "web 1")
+}
@@ -15,7 +15,10 @@
 package activation
 
 import (
+	"errors"
 	"net"
+	"os"
+	"syscall"
 )
 
 // PacketConns returns a slice containing a net.PacketConn for each matching socket type
@@ -24,14 +27,46 @@ import (
 // The order of the file descriptors is preserved in the returned slice.
 // Nil values are used to fill any gaps. For example if systemd were to return file descriptors
 // corresponding with "udp, tcp, udp", then the slice would contain {net.PacketConn, nil, net.PacketConn}
+//
+// Only datagram sockets are matched: UDP sockets are returned as *net.UDPConn,
+// and unix datagram sockets as *net.UnixConn.
 func PacketConns(unsetEnv bool) ([]net.PacketConn, error) {
 	files := Files(unsetEnv)
 	conns := make([]net.PacketConn, len(files))
 
 	for i, f := range files {
-		if pc, err := net.FilePacketConn(f); err == nil {
+		if pc, err := filePacketConn(f); err == nil {
 			conns[i] = pc
 		}
 	}
 	return conns, nil
 }
+
+// PacketConnsWithNames maps the names of the sockets passed to this process to
+// a net.PacketConn for each of them, like ListenersWithNames does for
+// listeners.
+func PacketConnsWithNames(unsetEnv bool) (map[string][]net.PacketConn, error) {
+	files := Files(unsetEnv)
+	conns := map[string][]net.PacketConn{}
+
+	for _, f := range files {
+		if pc, err := filePacketConn(f); err == nil {
+			conns[f.Name()] = append(conns[f.Name()], pc)
+		}
+	}
+	return conns, nil
+}
+
+// filePacketConn returns a net.PacketConn for f if it is a datagram socket.
+// net.FilePacketConn alone would also accept unix stream sockets.
+func filePacketConn(f *os.File) (net.PacketConn, error) {
+	sotype, err := syscall.GetsockoptInt(int(f.Fd()), syscall.SOL_SOCKET, syscall.SO_TYPE)
+	if err != nil {
+		return nil, err
+	}
+	if sotype != syscall.SOCK_DGRAM {
+		return nil, errors.New("not a datagram socket: " + f.Name())
+	}
+
+	return net.FilePacketConn(f)
+}
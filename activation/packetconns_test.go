@@ -15,9 +15,11 @@
 package activation
 
 import (
+	"io/ioutil"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
 )
 
@@ -28,11 +30,11 @@ func TestPacketConns(t *testing.T) {
 
 	u1, err := net.ListenUDP("udp", &net.UDPAddr{Port: 9999})
 	if err != nil {
-		t.Fatalf(err.Error())
+		t.Fatal(err)
 	}
 	u2, err := net.ListenUDP("udp", &net.UDPAddr{Port: 1234})
 	if err != nil {
-		t.Fatalf(err.Error())
+		t.Fatal(err)
 	}
 
 	f1, _ := u1.File()
@@ -45,13 +47,13 @@ func TestPacketConns(t *testing.T) {
 
 	r1, err := net.Dial("udp", "127.0.0.1:9999")
 	if err != nil {
-		t.Fatalf(err.Error())
+		t.Fatal(err)
 	}
 	r1.Write([]byte("Hi"))
 
 	r2, err := net.Dial("udp", "127.0.0.1:1234")
 	if err != nil {
-		t.Fatalf(err.Error())
+		t.Fatal(err)
 	}
 	r2.Write([]byte("Hi"))
 
@@ -66,3 +68,48 @@ func TestPacketConns(t *testing.T) {
 	correctStringWrittenNet(t, r1, "Hello world")
 	correctStringWrittenNet(t, r2, "Goodbye world")
 }
+
+// TestFilePacketConn ensures that unix datagram sockets are returned as
+// *net.UnixConn, while unix stream sockets are rejected.
+func TestFilePacketConn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "activation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	u, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(dir, "dgram"), Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer u.Close()
+	f, err := u.File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	pc, err := filePacketConn(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	if _, ok := pc.(*net.UnixConn); !ok {
+		t.Fatalf("Unexpected packet conn type %T", pc)
+	}
+
+	l, err := net.Listen("unix", filepath.Join(dir, "stream"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	f, err = l.(*net.UnixListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := filePacketConn(f); err == nil {
+		t.Fatalf("Expected an error for a stream socket")
+	}
+}
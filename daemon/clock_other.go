@@ -0,0 +1,28 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux
+// +build !linux
+
+package daemon
+
+import (
+	"errors"
+)
+
+// monotonicUsec fails, as the CLOCK_MONOTONIC time systemd expects can only
+// be read on Linux.
+func monotonicUsec() (uint64, error) {
+	return 0, errors.New("reading CLOCK_MONOTONIC is only supported on Linux")
+}
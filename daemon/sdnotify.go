@@ -3,14 +3,121 @@ package daemon
 
 import (
 	"errors"
+	"io"
 	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var SdNotifyNoSocket = errors.New("No socket")
 
 // SdNotify sends a message to the init daemon. It is common to ignore the error.
 func SdNotify(state string) error {
+	return sdNotify(false, state, nil)
+}
+
+// SdNotifyWithFds works like SdNotify, but also passes the given file
+// descriptors to the init daemon, e.g. to keep them in the file descriptor
+// store of the service across restarts with a state of FDSTORE=1. The
+// descriptors may be named by adding FDNAME=name to the state, in which case
+// the name must be at most 255 characters long, and made of printable ASCII
+// characters other than ':'. If unsetEnv is true, the NOTIFY_SOCKET
+// environment variable is unset, so that later notifications are not sent.
+func SdNotifyWithFds(unsetEnv bool, state string, fds ...int) error {
+	for _, line := range strings.Split(state, "\n") {
+		if strings.HasPrefix(line, "FDNAME=") && !validFdName(line[len("FDNAME="):]) {
+			return errors.New("invalid file descriptor name: " + line[len("FDNAME="):])
+		}
+	}
+
+	var oob []byte
+	if len(fds) > 0 {
+		var err error
+		if oob, err = unixRights(fds); err != nil {
+			return err
+		}
+	}
+	return sdNotify(unsetEnv, state, oob)
+}
+
+// SdNotifyBarrier waits until the init daemon has processed all the
+// notifications sent before, e.g. before exec-ing another binary. It sends
+// BARRIER=1 along with the write end of a pipe, which the init daemon closes
+// once done, and waits for the read end to reach end of file, for at most
+// timeout.
+func SdNotifyBarrier(timeout time.Duration) error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	err = SdNotifyWithFds(false, "BARRIER=1", int(w.Fd()))
+	// The init daemon now holds the only other copy of the write end
+	w.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := r.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	buf := make([]byte, 1)
+	for {
+		_, err := r.Read(buf)
+		if err == io.EOF {
+			return nil
+		}
+		if os.IsTimeout(err) {
+			return errors.New("timed out waiting for the barrier")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// NotifyReady tells the init daemon that startup is finished, or that a
+// reload is complete. It sends READY=1.
+func NotifyReady() error {
+	return SdNotify("READY=1")
+}
+
+// NotifyReloading tells the init daemon that the service is reloading its
+// configuration, and should be followed by NotifyReady once done. It sends
+// RELOADING=1 along with the current CLOCK_MONOTONIC time in MONOTONIC_USEC,
+// as required for Type=notify-reload services. It is only supported on
+// Linux.
+func NotifyReloading() error {
+	usec, err := monotonicUsec()
+	if err != nil {
+		return err
+	}
+	return SdNotify("RELOADING=1\nMONOTONIC_USEC=" + strconv.FormatUint(usec, 10))
+}
+
+// NotifyStopping tells the init daemon that the service is shutting down. It
+// sends STOPPING=1.
+func NotifyStopping() error {
+	return SdNotify("STOPPING=1")
+}
+
+// NotifyStatus passes a single-line status description to the init daemon,
+// as shown by systemctl status. It sends STATUS=status.
+func NotifyStatus(status string) error {
+	if strings.ContainsRune(status, '\n') {
+		return errors.New("status must be a single line")
+	}
+	return SdNotify("STATUS=" + status)
+}
+
+func sdNotify(unsetEnv bool, state string, oob []byte) error {
+	if unsetEnv {
+		defer os.Unsetenv("NOTIFY_SOCKET")
+	}
+
 	socketAddr := &net.UnixAddr{
 		Name: os.Getenv("NOTIFY_SOCKET"),
 		Net:  "unixgram",
@@ -20,12 +127,26 @@ func SdNotify(state string) error {
 		return SdNotifyNoSocket
 	}
 
-	conn, err := net.DialUnix(socketAddr.Net, nil, socketAddr)
+	conn, err := notifyConn()
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	_, err = conn.Write([]byte(state))
+	_, _, err = conn.WriteMsgUnix([]byte(state), oob, socketAddr)
 	return err
 }
+
+// validFdName reports whether name can be used with FDNAME=, as described in
+// sd_pid_notify_with_fds(3).
+func validFdName(name string) bool {
+	if len(name) == 0 || len(name) > 255 {
+		return false
+	}
+	for _, c := range name {
+		if c < ' ' || c > '~' || c == ':' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,35 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package daemon
+
+import (
+	"errors"
+	"net"
+)
+
+// unixRights fails, as file descriptors can only be passed over unix sockets
+// on unix systems.
+func unixRights(fds []int) ([]byte, error) {
+	return nil, errors.New("passing file descriptors is not supported on this platform")
+}
+
+// notifyConn fails, as the init daemon can only be notified over a unixgram
+// socket, which is only available on unix systems.
+func notifyConn() (*net.UnixConn, error) {
+	return nil, errors.New("notifying the init daemon is not supported on this platform")
+}
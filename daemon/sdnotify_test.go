@@ -0,0 +1,210 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package daemon
+
+import (
+	"net"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// readNotification reads a notification from conn, along with the file
+// descriptors passed with it.
+func readNotification(t *testing.T, conn *net.UnixConn) (string, []int) {
+	msg, fds, err := recvNotification(conn)
+	if err != nil {
+		t.Fatalf("error reading notification: %v", err)
+	}
+	return msg, fds
+}
+
+func recvNotification(conn *net.UnixConn) (string, []int, error) {
+	buf := make([]byte, 4096)
+	oob := make([]byte, syscall.CmsgSpace(4*16))
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var fds []int
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return "", nil, err
+	}
+	for _, msg := range msgs {
+		rights, err := syscall.ParseUnixRights(&msg)
+		if err != nil {
+			return "", nil, err
+		}
+		fds = append(fds, rights...)
+	}
+
+	return string(buf[:n]), fds, nil
+}
+
+func TestSdNotify(t *testing.T) {
+	conn, cleanup := listenNotifySocket(t)
+	defer cleanup()
+
+	if err := SdNotify("READY=1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg, fds := readNotification(t, conn); msg != "READY=1" || len(fds) != 0 {
+		t.Errorf("expected READY=1 without file descriptors, got %q with %v", msg, fds)
+	}
+}
+
+func TestSdNotifyNoSocket(t *testing.T) {
+	defer setEnv(map[string]string{"NOTIFY_SOCKET": ""})()
+
+	if err := SdNotify("READY=1"); err != SdNotifyNoSocket {
+		t.Errorf("expected SdNotifyNoSocket, got %v", err)
+	}
+}
+
+func TestNotifyStatus(t *testing.T) {
+	conn, cleanup := listenNotifySocket(t)
+	defer cleanup()
+
+	if err := NotifyStatus("two\nlines"); err == nil {
+		t.Error("expected error for a multi-line status")
+	}
+
+	if err := NotifyStatus("serving"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Only the valid status may have been sent
+	if msg, _ := readNotification(t, conn); msg != "STATUS=serving" {
+		t.Errorf("expected STATUS=serving, got %q", msg)
+	}
+}
+
+func TestValidFdName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"stored", true},
+		{"with space", true},
+		{"a.b-c_d~", true},
+		{strings.Repeat("x", 255), true},
+
+		{"", false},
+		{strings.Repeat("x", 256), false},
+		{"with:colon", false},
+		{"tab\there", false},
+		{"non-ascii-é", false},
+		{"del\x7f", false},
+	}
+
+	for _, tt := range tests {
+		if valid := validFdName(tt.name); valid != tt.valid {
+			t.Errorf("validFdName(%q): expected %t, got %t", tt.name, tt.valid, valid)
+		}
+	}
+}
+
+func TestSdNotifyWithFdsInvalidName(t *testing.T) {
+	_, cleanup := listenNotifySocket(t)
+	defer cleanup()
+
+	if err := SdNotifyWithFds(false, "FDSTORE=1\nFDNAME=bad:name", 0); err == nil {
+		t.Error("expected error for an invalid FDNAME")
+	}
+}
+
+func TestSdNotifyWithFds(t *testing.T) {
+	conn, cleanup := listenNotifySocket(t)
+	defer cleanup()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if err := SdNotifyWithFds(true, "FDSTORE=1\nFDNAME=pipe", int(w.Fd())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := os.LookupEnv("NOTIFY_SOCKET"); ok {
+		t.Error("expected NOTIFY_SOCKET to be unset")
+	}
+
+	msg, fds := readNotification(t, conn)
+	if msg != "FDSTORE=1\nFDNAME=pipe" {
+		t.Errorf("unexpected notification %q", msg)
+	}
+	if len(fds) != 1 {
+		t.Fatalf("expected 1 file descriptor, got %d", len(fds))
+	}
+
+	// The received descriptor must be the write end of the pipe
+	received := os.NewFile(uintptr(fds[0]), "received")
+	defer received.Close()
+	if _, err := received.Write([]byte("x")); err != nil {
+		t.Fatalf("error writing to the received file descriptor: %v", err)
+	}
+	buf := make([]byte, 1)
+	if _, err := r.Read(buf); err != nil || buf[0] != 'x' {
+		t.Errorf("expected to read back x, got %q: %v", buf, err)
+	}
+}
+
+func TestSdNotifyBarrier(t *testing.T) {
+	conn, cleanup := listenNotifySocket(t)
+	defer cleanup()
+
+	// Play the init daemon: close the passed descriptor once the barrier
+	// is received
+	received := make(chan string, 1)
+	go func() {
+		msg, fds, _ := recvNotification(conn)
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+		received <- msg
+	}()
+
+	if err := SdNotifyBarrier(5 * time.Second); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msg := <-received; msg != "BARRIER=1" {
+		t.Errorf("expected BARRIER=1, got %q", msg)
+	}
+}
+
+func TestSdNotifyBarrierTimeout(t *testing.T) {
+	conn, cleanup := listenNotifySocket(t)
+	defer cleanup()
+
+	// Keep the passed descriptor open, so that the barrier is never reached
+	if err := SdNotifyBarrier(50 * time.Millisecond); err == nil {
+		t.Error("expected the barrier to time out")
+	}
+
+	_, fds := readNotification(t, conn)
+	for _, fd := range fds {
+		syscall.Close(fd)
+	}
+}
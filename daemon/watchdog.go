@@ -0,0 +1,98 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// SdWatchdogEnabled returns the watchdog interval configured for this process
+// with WatchdogSec=, within which it must send WATCHDOG=1 with SdNotify, or 0
+// if the watchdog is not enabled for it. If unsetEnv is true, the
+// WATCHDOG_USEC and WATCHDOG_PID environment variables are unset.
+func SdWatchdogEnabled(unsetEnv bool) (time.Duration, error) {
+	if unsetEnv {
+		defer os.Unsetenv("WATCHDOG_USEC")
+		defer os.Unsetenv("WATCHDOG_PID")
+	}
+
+	wusec := os.Getenv("WATCHDOG_USEC")
+	if wusec == "" {
+		return 0, nil
+	}
+	s, err := strconv.Atoi(wusec)
+	if err != nil {
+		return 0, fmt.Errorf("error converting WATCHDOG_USEC: %s", err)
+	}
+	if s <= 0 {
+		return 0, fmt.Errorf("error WATCHDOG_USEC must be a positive number")
+	}
+	interval := time.Duration(s) * time.Microsecond
+
+	// WATCHDOG_PID is optional, but the watchdog is meant for another
+	// process when it is set to a different one
+	wpid := os.Getenv("WATCHDOG_PID")
+	if wpid == "" {
+		return interval, nil
+	}
+	p, err := strconv.Atoi(wpid)
+	if err != nil {
+		return 0, fmt.Errorf("error converting WATCHDOG_PID: %s", err)
+	}
+	if os.Getpid() != p {
+		return 0, nil
+	}
+
+	return interval, nil
+}
+
+// WatchdogRunner keeps the watchdog of this process happy until ctx is done,
+// sending WATCHDOG=1 every half of the watchdog interval, as recommended by
+// sd_watchdog_enabled(3). Before each ping, healthCheck is called, if not nil:
+// while it returns an error, no ping is sent, so that systemd eventually
+// considers the process hung and acts according to WatchdogSec=.
+//
+// WatchdogRunner returns right away if the watchdog is not enabled for this
+// process. Otherwise, it returns nil once ctx is done, or the error of a failed
+// ping.
+func WatchdogRunner(ctx context.Context, healthCheck func() error) error {
+	interval, err := SdWatchdogEnabled(false)
+	if err != nil || interval == 0 {
+		return err
+	}
+
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if healthCheck != nil && healthCheck() != nil {
+			continue
+		}
+		if err := SdNotify("WATCHDOG=1"); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package daemon
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// setEnv sets the given environment variables, unsetting those with an empty
+// value, and returns a function restoring their previous values.
+func setEnv(vars map[string]string) func() {
+	old := make(map[string]string)
+	for k, v := range vars {
+		if prev, ok := os.LookupEnv(k); ok {
+			old[k] = prev
+		}
+		if v == "" {
+			os.Unsetenv(k)
+		} else {
+			os.Setenv(k, v)
+		}
+	}
+	return func() {
+		for k := range vars {
+			if prev, ok := old[k]; ok {
+				os.Setenv(k, prev)
+			} else {
+				os.Unsetenv(k)
+			}
+		}
+	}
+}
+
+// listenNotifySocket listens on a unixgram socket in a temporary directory and
+// points NOTIFY_SOCKET at it. The returned function closes it and restores
+// the environment.
+func listenNotifySocket(t *testing.T) (*net.UnixConn, func()) {
+	dir, err := ioutil.TempDir("", "go-systemd-notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := &net.UnixAddr{Name: filepath.Join(dir, "notify.sock"), Net: "unixgram"}
+	conn, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	restore := setEnv(map[string]string{"NOTIFY_SOCKET": addr.Name})
+
+	return conn, func() {
+		restore()
+		conn.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSdWatchdogEnabled(t *testing.T) {
+	mypid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		usec string
+		pid  string
+
+		delay time.Duration
+		err   bool
+	}{
+		// Not enabled
+		{"", "", 0, false},
+		{"", mypid, 0, false},
+
+		// Enabled for this process
+		{"100", "", 100 * time.Microsecond, false},
+		{"100", mypid, 100 * time.Microsecond, false},
+
+		// Enabled for another process
+		{"100", "1", 0, false},
+
+		// Invalid values
+		{"not_a_number", "", 0, true},
+		{"-1", "", 0, true},
+		{"0", "", 0, true},
+		{"100", "not_a_number", 0, true},
+	}
+
+	for i, tt := range tests {
+		restore := setEnv(map[string]string{"WATCHDOG_USEC": tt.usec, "WATCHDOG_PID": tt.pid})
+		delay, err := SdWatchdogEnabled(false)
+		restore()
+
+		if tt.err && err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+		if !tt.err && err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+		if delay != tt.delay {
+			t.Errorf("case %d: expected delay %v, got %v", i, tt.delay, delay)
+		}
+	}
+}
+
+func TestSdWatchdogEnabledUnsetEnv(t *testing.T) {
+	restore := setEnv(map[string]string{"WATCHDOG_USEC": "100", "WATCHDOG_PID": strconv.Itoa(os.Getpid())})
+	defer restore()
+
+	delay, err := SdWatchdogEnabled(true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if delay != 100*time.Microsecond {
+		t.Errorf("expected delay of 100µs, got %v", delay)
+	}
+
+	for _, name := range []string{"WATCHDOG_USEC", "WATCHDOG_PID"} {
+		if v, ok := os.LookupEnv(name); ok {
+			t.Errorf("expected %s to be unset, got %q", name, v)
+		}
+	}
+}
+
+func TestWatchdogRunner(t *testing.T) {
+	conn, cleanup := listenNotifySocket(t)
+	defer cleanup()
+	defer setEnv(map[string]string{"WATCHDOG_USEC": "20000", "WATCHDOG_PID": ""})()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- WatchdogRunner(ctx, nil)
+	}()
+
+	buf := make([]byte, 64)
+	for i := 0; i < 2; i++ {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("error reading notification: %v", err)
+		}
+		if msg := string(buf[:n]); msg != "WATCHDOG=1" {
+			t.Fatalf("expected WATCHDOG=1, got %q", msg)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchdogRunner did not return once ctx was done")
+	}
+}
+
+func TestWatchdogRunnerNotEnabled(t *testing.T) {
+	defer setEnv(map[string]string{"WATCHDOG_USEC": "", "WATCHDOG_PID": ""})()
+
+	if err := WatchdogRunner(context.Background(), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
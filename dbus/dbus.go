@@ -23,6 +23,7 @@ import (
 	"sync"
 
 	"github.com/godbus/dbus"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -62,6 +63,10 @@ func PathBusEscape(path string) string {
 
 // Conn is a connection to systemd's dbus endpoint.
 type Conn struct {
+	// connMu guards the connections and lost, which Reconnect replaces;
+	// use sysConn, sysObject, sigConn and sigObject to get them
+	connMu sync.RWMutex
+
 	// sysconn/sysobj are only used to call dbus methods
 	sysconn *dbus.Conn
 	sysobj  dbus.BusObject
@@ -70,16 +75,32 @@ type Conn struct {
 	sigconn *dbus.Conn
 	sigobj  dbus.BusObject
 
+	// createBus opens the underlying connections, again on Reconnect
+	createBus func() (*dbus.Conn, error)
+	// lost is closed once the signal connection is closed or lost
+	lost chan struct{}
+	// reconnectMu serializes calls to Reconnect
+	reconnectMu sync.Mutex
+
 	jobListener struct {
 		jobs map[dbus.ObjectPath]chan<- string
 		sync.Mutex
 	}
+	jobSubscriber struct {
+		removedCh chan<- *JobRemoved
+		sync.Mutex
+	}
 	subscriber struct {
 		updateCh chan<- *SubStateUpdate
 		errCh    chan<- error
 		sync.Mutex
 		ignore      map[dbus.ObjectPath]int64
 		cleanIgnore int64
+		subscribed  bool // whether Subscribe was called, to be redone on Reconnect
+	}
+	unitSubscriber struct {
+		units map[dbus.ObjectPath][]unitSubscription
+		sync.Mutex
 	}
 }
 
@@ -112,63 +133,203 @@ func NewSystemdConnection() (*Conn, error) {
 	})
 }
 
+// NewConnectionForAddress establishes a connection to the bus at the given
+// dbus address and authenticates, which allows managing the systemd instance
+// of another machine. Besides the unix: and tcp: transports, unixexec: is
+// supported, e.g. to go through ssh with
+// unixexec:path=ssh,argv1=host,argv2=systemd-stdio-bridge.
+//
+// By default, the EXTERNAL authentication method is used with the uid of the
+// current process, as with New. Other methods, e.g. for a tcp: bus, may be
+// given instead. Callers should call Close() when done with the connection.
+func NewConnectionForAddress(address string, methods ...dbus.Auth) (*Conn, error) {
+	return newConnection(func() (*dbus.Conn, error) {
+		return dbusAuthHelloConnection(func() (*dbus.Conn, error) {
+			if strings.HasPrefix(address, "unixexec:") {
+				return dialUnixExec(address)
+			}
+			return dbus.Dial(address)
+		}, methods...)
+	})
+}
+
 // Close closes an established connection
 func (c *Conn) Close() {
-	c.sysconn.Close()
-	c.sigconn.Close()
+	c.sysConn().Close()
+	c.sigConn().Close()
+}
+
+// sysConn returns the connection used to call dbus methods.
+func (c *Conn) sysConn() *dbus.Conn {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.sysconn
+}
+
+// sysObject returns the systemd object of the connection used to call dbus
+// methods.
+func (c *Conn) sysObject() dbus.BusObject {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.sysobj
+}
+
+// sigConn returns the connection used to receive dbus signals.
+func (c *Conn) sigConn() *dbus.Conn {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.sigconn
+}
+
+// sigObject returns the systemd object of the connection used to receive dbus
+// signals.
+func (c *Conn) sigObject() dbus.BusObject {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.sigobj
 }
 
 func newConnection(createBus func() (*dbus.Conn, error)) (*Conn, error) {
-	sysconn, err := createBus()
-	if err != nil {
+	c := &Conn{createBus: createBus}
+
+	c.subscriber.ignore = make(map[dbus.ObjectPath]int64)
+	c.jobListener.jobs = make(map[dbus.ObjectPath]chan<- string)
+	c.unitSubscriber.units = make(map[dbus.ObjectPath][]unitSubscription)
+
+	if err := c.connect(); err != nil {
 		return nil, err
 	}
+	return c, nil
+}
 
-	sigconn, err := createBus()
+// connect opens the method and signal connections, and starts dispatching
+// signals.
+func (c *Conn) connect() error {
+	sysconn, err := c.createBus()
 	if err != nil {
-		sysconn.Close()
-		return nil, err
+		return err
 	}
 
-	c := &Conn{
-		sysconn: sysconn,
-		sysobj:  systemdObject(sysconn),
-		sigconn: sigconn,
-		sigobj:  systemdObject(sigconn),
+	sigconn, err := c.createBus()
+	if err != nil {
+		sysconn.Close()
+		return err
 	}
 
-	c.subscriber.ignore = make(map[dbus.ObjectPath]int64)
-	c.jobListener.jobs = make(map[dbus.ObjectPath]chan<- string)
+	lost := make(chan struct{})
 
 	// Setup the listeners on jobs so that we can get completions
-	c.sigconn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0,
+	sigconn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0,
 		"type='signal', interface='org.freedesktop.systemd1.Manager', member='JobRemoved'")
 
-	c.dispatch()
-	return c, nil
+	c.connMu.Lock()
+	c.sysconn = sysconn
+	c.sysobj = systemdObject(sysconn)
+	c.sigconn = sigconn
+	c.sigobj = systemdObject(sigconn)
+	c.lost = lost
+	c.connMu.Unlock()
+
+	c.dispatch(sigconn, lost)
+	return nil
+}
+
+// Lost returns a channel that is closed once the connection is lost, e.g.
+// because the dbus daemon was restarted, or closed with Close. Reconnect may
+// then be used to connect again. The channel is replaced on Reconnect, so Lost
+// must be called again afterwards.
+func (c *Conn) Lost() <-chan struct{} {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.lost
+}
+
+// Reconnect closes the connection and connects again the same way, e.g. after
+// it was lost, then restores the subscriptions made with Subscribe and
+// SubscribeUnitState, as well as the signal subscribers. Jobs enqueued before
+// may still report their completion on the channels they were given, if they
+// finish after reconnecting. Other methods, e.g. the polling of SubscribeUnits,
+// may keep being used meanwhile: calls made before the new connection is
+// established fail like on a lost connection.
+func (c *Conn) Reconnect() error {
+	c.reconnectMu.Lock()
+	defer c.reconnectMu.Unlock()
+
+	c.Close()
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	c.subscriber.Lock()
+	subscribed := c.subscriber.subscribed
+	c.subscriber.Unlock()
+	if subscribed {
+		if err := c.Subscribe(); err != nil {
+			return err
+		}
+	}
+
+	c.unitSubscriber.Lock()
+	defer c.unitSubscriber.Unlock()
+	for path := range c.unitSubscriber.units {
+		err := c.sigConn().BusObject().Call("org.freedesktop.DBus.AddMatch", 0, unitStateMatch(path)).Store()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 // GetManagerProperty returns the value of a property on the org.freedesktop.systemd1.Manager
 // interface. The value is returned in its string representation, as defined at
 // https://developer.gnome.org/glib/unstable/gvariant-text.html
 func (c *Conn) GetManagerProperty(prop string) (string, error) {
-	variant, err := c.sysobj.GetProperty("org.freedesktop.systemd1.Manager." + prop)
+	return c.GetManagerPropertyContext(context.Background(), prop)
+}
+
+// GetManagerPropertyContext is the same as GetManagerProperty, but stops
+// waiting for systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) GetManagerPropertyContext(ctx context.Context, prop string) (string, error) {
+	var variant dbus.Variant
+	err := callContext(ctx, c.sysObject(), "org.freedesktop.DBus.Properties.Get", 0, "org.freedesktop.systemd1.Manager", prop).Store(&variant)
 	if err != nil {
 		return "", err
 	}
 	return variant.String(), nil
 }
 
-func dbusAuthConnection(createBus func() (*dbus.Conn, error)) (*dbus.Conn, error) {
+// callContext calls a method on obj like obj.Call, but stops waiting for the
+// reply once ctx is done, returning a call holding ctx.Err() as its error. The
+// method call itself cannot be taken back, so systemd may still carry it out.
+func callContext(ctx context.Context, obj dbus.BusObject, method string, flags dbus.Flags, args ...interface{}) *dbus.Call {
+	select {
+	case <-ctx.Done():
+		return &dbus.Call{Method: method, Args: args, Err: ctx.Err()}
+	default:
+	}
+
+	call := obj.Go(method, flags, make(chan *dbus.Call, 1), args...)
+	select {
+	case <-call.Done:
+		return call
+	case <-ctx.Done():
+		return &dbus.Call{Method: method, Args: args, Err: ctx.Err()}
+	}
+}
+
+func dbusAuthConnection(createBus func() (*dbus.Conn, error), methods ...dbus.Auth) (*dbus.Conn, error) {
 	conn, err := createBus()
 	if err != nil {
 		return nil, err
 	}
 
-	// Only use EXTERNAL method, and hardcode the uid (not username)
-	// to avoid a username lookup (which requires a dynamically linked
-	// libc)
-	methods := []dbus.Auth{dbus.AuthExternal(strconv.Itoa(os.Getuid()))}
+	if len(methods) == 0 {
+		// Only use EXTERNAL method, and hardcode the uid (not username)
+		// to avoid a username lookup (which requires a dynamically linked
+		// libc)
+		methods = []dbus.Auth{dbus.AuthExternal(strconv.Itoa(os.Getuid()))}
+	}
 
 	err = conn.Auth(methods)
 	if err != nil {
@@ -179,8 +340,8 @@ func dbusAuthConnection(createBus func() (*dbus.Conn, error)) (*dbus.Conn, error
 	return conn, nil
 }
 
-func dbusAuthHelloConnection(createBus func() (*dbus.Conn, error)) (*dbus.Conn, error) {
-	conn, err := dbusAuthConnection(createBus)
+func dbusAuthHelloConnection(createBus func() (*dbus.Conn, error), methods ...dbus.Auth) (*dbus.Conn, error) {
+	conn, err := dbusAuthConnection(createBus, methods...)
 	if err != nil {
 		return nil, err
 	}
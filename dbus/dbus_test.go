@@ -16,6 +16,10 @@ package dbus
 
 import (
 	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+	"golang.org/x/net/context"
 )
 
 func TestNeedsEscape(t *testing.T) {
@@ -67,6 +71,27 @@ func TestPathBusEscape(t *testing.T) {
 
 }
 
+// hungObject is a dbus object never replying to method calls.
+type hungObject struct {
+	dbus.BusObject
+}
+
+func (hungObject) Go(method string, flags dbus.Flags, ch chan *dbus.Call, args ...interface{}) *dbus.Call {
+	return &dbus.Call{Method: method, Args: args, Done: ch}
+}
+
+// TestCallContext ensures that callContext gives up on a call once its context
+// is done.
+func TestCallContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := callContext(ctx, hungObject{}, "org.freedesktop.systemd1.Manager.Reload", 0).Store()
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected the deadline to be exceeded, got: %v", err)
+	}
+}
+
 // TestNew ensures that New() works without errors.
 func TestNew(t *testing.T) {
 	_, err := New()
@@ -75,3 +100,67 @@ func TestNew(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestReconnect ensures that a closed connection can be used again after
+// Reconnect.
+func TestReconnect(t *testing.T) {
+	conn, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	lost := conn.Lost()
+	conn.Close()
+	select {
+	case <-lost:
+	case <-time.After(time.Second):
+		t.Fatal("Lost channel not closed along with the connection")
+	}
+
+	if err := conn.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.GetManagerProperty("Version"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestReconnectConcurrent ensures that the connection can be reconnected
+// while it is used from another goroutine, as with SubscribeUnits.
+func TestReconnectConcurrent(t *testing.T) {
+	conn, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			// calls racing with Reconnect may fail, but must not crash
+			conn.ListUnits()
+			conn.Lost()
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		if err := conn.Reconnect(); err != nil {
+			close(stop)
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	<-done
+
+	if _, err := conn.GetManagerProperty("Version"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"strconv"
 
 	"github.com/godbus/dbus"
+	"golang.org/x/net/context"
 )
 
 func (c *Conn) jobComplete(signal *dbus.Signal) {
@@ -35,28 +36,115 @@ func (c *Conn) jobComplete(signal *dbus.Signal) {
 		delete(c.jobListener.jobs, job)
 	}
 	c.jobListener.Unlock()
+
+	c.jobSubscriber.Lock()
+	if c.jobSubscriber.removedCh != nil {
+		select {
+		case c.jobSubscriber.removedCh <- &JobRemoved{id, job, unit, result}:
+		default:
+		}
+	}
+	c.jobSubscriber.Unlock()
+}
+
+// JobRemoved describes a job that finished, as reported by the JobRemoved
+// signal of systemd.
+type JobRemoved struct {
+	ID     uint32          // The numeric job ID
+	Job    dbus.ObjectPath // The job object path
+	Unit   string          // The primary name of the unit the job was for
+	Result string          // One of done, canceled, timeout, failed, dependency, skipped; see StartUnit
+}
+
+// SetJobRemovedSubscriber writes to removedCh whenever a job finishes. Jobs
+// enqueued by other clients are only reported after calling Subscribe. As
+// with SetSubStateSubscriber, updates are written with non-blocking writes,
+// and dropped if removedCh is full. A nil removedCh stops the updates.
+func (c *Conn) SetJobRemovedSubscriber(removedCh chan<- *JobRemoved) {
+	c.jobSubscriber.Lock()
+	defer c.jobSubscriber.Unlock()
+	c.jobSubscriber.removedCh = removedCh
+}
+
+// WaitForJob waits for the job with the given object path, e.g. as returned by
+// StartTransientUnitWithOptions, to finish and returns its result, as sent on
+// the channel passed to StartUnit. An error is returned if the job is already
+// gone, in which case its result can no longer be known: passing a channel
+// when enqueuing the job is the only race-free way of getting the result.
+func (c *Conn) WaitForJob(job dbus.ObjectPath) (string, error) {
+	return c.WaitForJobContext(context.Background(), job)
 }
 
-func (c *Conn) startJob(ch chan<- string, job string, args ...interface{}) (int, error) {
+// WaitForJobContext is the same as WaitForJob, but stops waiting and returns
+// ctx.Err() once ctx is done.
+func (c *Conn) WaitForJobContext(ctx context.Context, job dbus.ObjectPath) (string, error) {
+	ch := make(chan string, 1)
+
+	c.jobListener.Lock()
+	if _, ok := c.jobListener.jobs[job]; ok {
+		c.jobListener.Unlock()
+		return "", errors.New("job is already being waited for: " + string(job))
+	}
+	c.jobListener.jobs[job] = ch
+	c.jobListener.Unlock()
+
+	// Now that a JobRemoved signal cannot be missed, make sure that the job
+	// has not finished before
+	obj := c.sysConn().Object("org.freedesktop.systemd1", job)
+	var state dbus.Variant
+	err := callContext(ctx, obj, "org.freedesktop.DBus.Properties.Get", 0, "org.freedesktop.systemd1.Job", "State").Store(&state)
+	if err == nil {
+		select {
+		case result := <-ch:
+			return result, nil
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	c.jobListener.Lock()
+	delete(c.jobListener.jobs, job)
+	c.jobListener.Unlock()
+
+	// The job may have finished in the meantime
+	select {
+	case result := <-ch:
+		return result, nil
+	default:
+		return "", err
+	}
+}
+
+func (c *Conn) startJob(ctx context.Context, ch chan<- string, job string, args ...interface{}) (int, error) {
+	p, err := c.startJobPath(ctx, ch, job, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	// ignore error since 0 is fine if conversion fails
+	jobID, _ := strconv.Atoi(path.Base(string(p)))
+
+	return jobID, nil
+}
+
+// startJobPath works like startJob, but returns the object path of the job.
+func (c *Conn) startJobPath(ctx context.Context, ch chan<- string, job string, args ...interface{}) (dbus.ObjectPath, error) {
 	if ch != nil {
 		c.jobListener.Lock()
 		defer c.jobListener.Unlock()
 	}
 
 	var p dbus.ObjectPath
-	err := c.sysobj.Call(job, 0, args...).Store(&p)
+	err := callContext(ctx, c.sysObject(), job, 0, args...).Store(&p)
 	if err != nil {
-		return 0, err
+		return "", err
 	}
 
 	if ch != nil {
 		c.jobListener.jobs[p] = ch
 	}
 
-	// ignore error since 0 is fine if conversion fails
-	jobID, _ := strconv.Atoi(path.Base(string(p)))
-
-	return jobID, nil
+	return p, nil
 }
 
 // StartUnit enqueues a start job and depending jobs, if any (unless otherwise
@@ -90,42 +178,84 @@ func (c *Conn) startJob(ch chan<- string, job string, args ...interface{}) (int,
 //
 // If an error does occur, it will be returned to the user alongside a job ID of 0.
 func (c *Conn) StartUnit(name string, mode string, ch chan<- string) (int, error) {
-	return c.startJob(ch, "org.freedesktop.systemd1.Manager.StartUnit", name, mode)
+	return c.StartUnitContext(context.Background(), name, mode, ch)
+}
+
+// StartUnitContext is the same as StartUnit, but stops waiting for systemd and
+// returns ctx.Err() once ctx is done.
+func (c *Conn) StartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.startJob(ctx, ch, "org.freedesktop.systemd1.Manager.StartUnit", name, mode)
 }
 
 // StopUnit is similar to StartUnit but stops the specified unit rather
 // than starting it.
 func (c *Conn) StopUnit(name string, mode string, ch chan<- string) (int, error) {
-	return c.startJob(ch, "org.freedesktop.systemd1.Manager.StopUnit", name, mode)
+	return c.StopUnitContext(context.Background(), name, mode, ch)
+}
+
+// StopUnitContext is the same as StopUnit, but stops waiting for systemd and
+// returns ctx.Err() once ctx is done.
+func (c *Conn) StopUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.startJob(ctx, ch, "org.freedesktop.systemd1.Manager.StopUnit", name, mode)
 }
 
 // ReloadUnit reloads a unit.  Reloading is done only if the unit is already running and fails otherwise.
 func (c *Conn) ReloadUnit(name string, mode string, ch chan<- string) (int, error) {
-	return c.startJob(ch, "org.freedesktop.systemd1.Manager.ReloadUnit", name, mode)
+	return c.ReloadUnitContext(context.Background(), name, mode, ch)
+}
+
+// ReloadUnitContext is the same as ReloadUnit, but stops waiting for systemd
+// and returns ctx.Err() once ctx is done.
+func (c *Conn) ReloadUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.startJob(ctx, ch, "org.freedesktop.systemd1.Manager.ReloadUnit", name, mode)
 }
 
 // RestartUnit restarts a service.  If a service is restarted that isn't
 // running it will be started.
 func (c *Conn) RestartUnit(name string, mode string, ch chan<- string) (int, error) {
-	return c.startJob(ch, "org.freedesktop.systemd1.Manager.RestartUnit", name, mode)
+	return c.RestartUnitContext(context.Background(), name, mode, ch)
+}
+
+// RestartUnitContext is the same as RestartUnit, but stops waiting for systemd
+// and returns ctx.Err() once ctx is done.
+func (c *Conn) RestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.startJob(ctx, ch, "org.freedesktop.systemd1.Manager.RestartUnit", name, mode)
 }
 
 // TryRestartUnit is like RestartUnit, except that a service that isn't running
 // is not affected by the restart.
 func (c *Conn) TryRestartUnit(name string, mode string, ch chan<- string) (int, error) {
-	return c.startJob(ch, "org.freedesktop.systemd1.Manager.TryRestartUnit", name, mode)
+	return c.TryRestartUnitContext(context.Background(), name, mode, ch)
+}
+
+// TryRestartUnitContext is the same as TryRestartUnit, but stops waiting for
+// systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) TryRestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.startJob(ctx, ch, "org.freedesktop.systemd1.Manager.TryRestartUnit", name, mode)
 }
 
 // ReloadOrRestart attempts a reload if the unit supports it and use a restart
 // otherwise.
 func (c *Conn) ReloadOrRestartUnit(name string, mode string, ch chan<- string) (int, error) {
-	return c.startJob(ch, "org.freedesktop.systemd1.Manager.ReloadOrRestartUnit", name, mode)
+	return c.ReloadOrRestartUnitContext(context.Background(), name, mode, ch)
+}
+
+// ReloadOrRestartUnitContext is the same as ReloadOrRestartUnit, but stops
+// waiting for systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) ReloadOrRestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.startJob(ctx, ch, "org.freedesktop.systemd1.Manager.ReloadOrRestartUnit", name, mode)
 }
 
 // ReloadOrTryRestart attempts a reload if the unit supports it and use a "Try"
 // flavored restart otherwise.
 func (c *Conn) ReloadOrTryRestartUnit(name string, mode string, ch chan<- string) (int, error) {
-	return c.startJob(ch, "org.freedesktop.systemd1.Manager.ReloadOrTryRestartUnit", name, mode)
+	return c.ReloadOrTryRestartUnitContext(context.Background(), name, mode, ch)
+}
+
+// ReloadOrTryRestartUnitContext is the same as ReloadOrTryRestartUnit, but
+// stops waiting for systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) ReloadOrTryRestartUnitContext(ctx context.Context, name string, mode string, ch chan<- string) (int, error) {
+	return c.startJob(ctx, ch, "org.freedesktop.systemd1.Manager.ReloadOrTryRestartUnit", name, mode)
 }
 
 // StartTransientUnit() may be used to create and start a transient unit, which
@@ -134,22 +264,131 @@ func (c *Conn) ReloadOrTryRestartUnit(name string, mode string, ch chan<- string
 // unique. mode is the same as in StartUnit(), properties contains properties
 // of the unit.
 func (c *Conn) StartTransientUnit(name string, mode string, properties []Property, ch chan<- string) (int, error) {
-	return c.startJob(ch, "org.freedesktop.systemd1.Manager.StartTransientUnit", name, mode, properties, make([]PropertyCollection, 0))
+	return c.StartTransientUnitContext(context.Background(), name, mode, properties, ch)
+}
+
+// StartTransientUnitContext is the same as StartTransientUnit, but stops
+// waiting for systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) StartTransientUnitContext(ctx context.Context, name string, mode string, properties []Property, ch chan<- string) (int, error) {
+	return c.startJob(ctx, ch, "org.freedesktop.systemd1.Manager.StartTransientUnit", name, mode, properties, make([]PropertyCollection, 0))
+}
+
+// StartTransientUnitWithOptions works like StartTransientUnit, but builds the
+// properties of the unit from opts, and returns the object path of the job
+// rather than its ID.
+func (c *Conn) StartTransientUnitWithOptions(name string, mode string, opts *TransientUnitOptions, ch chan<- string) (dbus.ObjectPath, error) {
+	return c.StartTransientUnitWithOptionsContext(context.Background(), name, mode, opts, ch)
+}
+
+// StartTransientUnitWithOptionsContext is the same as
+// StartTransientUnitWithOptions, but stops waiting for systemd and returns
+// ctx.Err() once ctx is done.
+func (c *Conn) StartTransientUnitWithOptionsContext(ctx context.Context, name string, mode string, opts *TransientUnitOptions, ch chan<- string) (dbus.ObjectPath, error) {
+	return c.startJobPath(ctx, ch, "org.freedesktop.systemd1.Manager.StartTransientUnit", name, mode, opts.properties(), make([]PropertyCollection, 0))
 }
 
 // KillUnit takes the unit name and a UNIX signal number to send.  All of the unit's
 // processes are killed.
 func (c *Conn) KillUnit(name string, signal int32) {
-	c.sysobj.Call("org.freedesktop.systemd1.Manager.KillUnit", 0, name, "all", signal).Store()
+	c.KillUnitContext(context.Background(), name, signal)
+}
+
+// KillUnitContext is the same as KillUnit, but stops waiting for systemd once
+// ctx is done.
+func (c *Conn) KillUnitContext(ctx context.Context, name string, signal int32) {
+	c.KillUnitWithTargetContext(ctx, name, "all", signal)
 }
 
-// ResetFailedUnit resets the "failed" state of a specific unit.
+// KillUnitWithTarget sends a UNIX signal to the processes of the named unit
+// selected by who: "main" for the main process, "control" for the control
+// process, e.g. one running ExecReload=, or "all" for all of them, like
+// systemctl kill --kill-whom. Unlike KillUnit, it reports errors, e.g. when
+// the unit has no process of the given kind.
+func (c *Conn) KillUnitWithTarget(name string, who string, signal int32) error {
+	return c.KillUnitWithTargetContext(context.Background(), name, who, signal)
+}
+
+// KillUnitWithTargetContext is the same as KillUnitWithTarget, but stops
+// waiting for systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) KillUnitWithTargetContext(ctx context.Context, name string, who string, signal int32) error {
+	switch who {
+	case "main", "control", "all":
+	default:
+		return errors.New("invalid kill target " + strconv.Quote(who) + ": must be main, control or all")
+	}
+	return callContext(ctx, c.sysObject(), "org.freedesktop.systemd1.Manager.KillUnit", 0, name, who, signal).Store()
+}
+
+// ResetFailedUnit resets the "failed" state of a specific unit. If the unit is
+// not loaded, the dbus.Error returned by systemd is named
+// org.freedesktop.systemd1.NoSuchUnit, and its message names the unit.
 func (c *Conn) ResetFailedUnit(name string) error {
-	return c.sysobj.Call("org.freedesktop.systemd1.Manager.ResetFailedUnit", 0, name).Store()
+	return c.ResetFailedUnitContext(context.Background(), name)
+}
+
+// ResetFailedUnitContext is the same as ResetFailedUnit, but stops waiting for
+// systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) ResetFailedUnitContext(ctx context.Context, name string) error {
+	return callContext(ctx, c.sysObject(), "org.freedesktop.systemd1.Manager.ResetFailedUnit", 0, name).Store()
+}
+
+// ResetFailed resets the "failed" state of all units, like systemctl
+// reset-failed.
+func (c *Conn) ResetFailed() error {
+	return c.ResetFailedContext(context.Background())
+}
+
+// ResetFailedContext is the same as ResetFailed, but stops waiting for systemd
+// and returns ctx.Err() once ctx is done.
+func (c *Conn) ResetFailedContext(ctx context.Context) error {
+	return callContext(ctx, c.sysObject(), "org.freedesktop.systemd1.Manager.ResetFailed", 0).Store()
+}
+
+// FreezeUnit freezes the cgroup of the named unit, pausing all of its
+// processes until ThawUnit is called, like systemctl freeze. The unit's
+// FreezerState property, as returned by GetUnitProperties, reports its
+// progress. Freezing units requires systemd 246 or newer and cgroup v2, and
+// fails with ErrFreezeNotSupported otherwise.
+func (c *Conn) FreezeUnit(name string) error {
+	return c.FreezeUnitContext(context.Background(), name)
+}
+
+// FreezeUnitContext is the same as FreezeUnit, but stops waiting for systemd
+// and returns ctx.Err() once ctx is done.
+func (c *Conn) FreezeUnitContext(ctx context.Context, name string) error {
+	return c.freezer(ctx, "org.freedesktop.systemd1.Manager.FreezeUnit", name)
+}
+
+// ThawUnit resumes the processes of the named unit frozen by FreezeUnit, like
+// systemctl thaw.
+func (c *Conn) ThawUnit(name string) error {
+	return c.ThawUnitContext(context.Background(), name)
+}
+
+// ThawUnitContext is the same as ThawUnit, but stops waiting for systemd and
+// returns ctx.Err() once ctx is done.
+func (c *Conn) ThawUnitContext(ctx context.Context, name string) error {
+	return c.freezer(ctx, "org.freedesktop.systemd1.Manager.ThawUnit", name)
+}
+
+// ErrFreezeNotSupported is returned by FreezeUnit and ThawUnit when the
+// running systemd is older than 246, and lacks the methods.
+var ErrFreezeNotSupported = errors.New("freezing units is not supported by this systemd, which must be 246 or newer")
+
+// freezer calls one of the methods driving the cgroup freezer of the named
+// unit. Other errors than ErrFreezeNotSupported are the dbus.Error returned
+// by systemd, e.g. org.freedesktop.systemd1.NoSuchUnit if the unit is not
+// loaded.
+func (c *Conn) freezer(ctx context.Context, method string, name string) error {
+	err := callContext(ctx, c.sysObject(), method, 0, name).Store()
+	if e, ok := err.(dbus.Error); ok && e.Name == "org.freedesktop.DBus.Error.UnknownMethod" {
+		return ErrFreezeNotSupported
+	}
+	return err
 }
 
 // getProperties takes the unit name and returns all of its dbus object properties, for the given dbus interface
-func (c *Conn) getProperties(unit string, dbusInterface string) (map[string]interface{}, error) {
+func (c *Conn) getProperties(ctx context.Context, unit string, dbusInterface string) (map[string]interface{}, error) {
 	var err error
 	var props map[string]dbus.Variant
 
@@ -158,8 +397,8 @@ func (c *Conn) getProperties(unit string, dbusInterface string) (map[string]inte
 		return nil, errors.New("invalid unit name: " + unit)
 	}
 
-	obj := c.sysconn.Object("org.freedesktop.systemd1", path)
-	err = obj.Call("org.freedesktop.DBus.Properties.GetAll", 0, dbusInterface).Store(&props)
+	obj := c.sysConn().Object("org.freedesktop.systemd1", path)
+	err = callContext(ctx, obj, "org.freedesktop.DBus.Properties.GetAll", 0, dbusInterface).Store(&props)
 	if err != nil {
 		return nil, err
 	}
@@ -173,11 +412,19 @@ func (c *Conn) getProperties(unit string, dbusInterface string) (map[string]inte
 }
 
 // GetUnitProperties takes the unit name and returns all of its dbus object properties.
+// These include FreezerState, one of "running", "freezing", "frozen" or
+// "thawing", with systemd 246 or newer.
 func (c *Conn) GetUnitProperties(unit string) (map[string]interface{}, error) {
-	return c.getProperties(unit, "org.freedesktop.systemd1.Unit")
+	return c.GetUnitPropertiesContext(context.Background(), unit)
+}
+
+// GetUnitPropertiesContext is the same as GetUnitProperties, but stops waiting
+// for systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) GetUnitPropertiesContext(ctx context.Context, unit string) (map[string]interface{}, error) {
+	return c.getProperties(ctx, unit, "org.freedesktop.systemd1.Unit")
 }
 
-func (c *Conn) getProperty(unit string, dbusInterface string, propertyName string) (*Property, error) {
+func (c *Conn) getProperty(ctx context.Context, unit string, dbusInterface string, propertyName string) (*Property, error) {
 	var err error
 	var prop dbus.Variant
 
@@ -186,8 +433,8 @@ func (c *Conn) getProperty(unit string, dbusInterface string, propertyName strin
 		return nil, errors.New("invalid unit name: " + unit)
 	}
 
-	obj := c.sysconn.Object("org.freedesktop.systemd1", path)
-	err = obj.Call("org.freedesktop.DBus.Properties.Get", 0, dbusInterface, propertyName).Store(&prop)
+	obj := c.sysConn().Object("org.freedesktop.systemd1", path)
+	err = callContext(ctx, obj, "org.freedesktop.DBus.Properties.Get", 0, dbusInterface, propertyName).Store(&prop)
 	if err != nil {
 		return nil, err
 	}
@@ -195,15 +442,112 @@ func (c *Conn) getProperty(unit string, dbusInterface string, propertyName strin
 	return &Property{Name: propertyName, Value: prop}, nil
 }
 
+// GetUnitPropertiesByName works like GetUnitProperties, but only fetches the
+// given properties, one at a time, which is cheaper than getting all of them
+// when only a few are needed.
+func (c *Conn) GetUnitPropertiesByName(unit string, propertyNames ...string) (map[string]interface{}, error) {
+	return c.GetUnitPropertiesByNameContext(context.Background(), unit, propertyNames...)
+}
+
+// GetUnitPropertiesByNameContext is the same as GetUnitPropertiesByName, but
+// stops waiting for systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) GetUnitPropertiesByNameContext(ctx context.Context, unit string, propertyNames ...string) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(propertyNames))
+	for _, name := range propertyNames {
+		prop, err := c.getProperty(ctx, unit, "org.freedesktop.systemd1.Unit", name)
+		if err != nil {
+			return nil, err
+		}
+		out[name] = prop.Value.Value()
+	}
+
+	return out, nil
+}
+
+// UnitDependencies holds the dependencies of a unit on other units, in both
+// directions, e.g. Requires and RequiredBy. See
+// http://www.freedesktop.org/software/systemd/man/systemd.unit.html
+type UnitDependencies struct {
+	Requires     []string
+	Requisite    []string
+	Wants        []string
+	BindsTo      []string
+	PartOf       []string
+	Conflicts    []string
+	RequiredBy   []string
+	RequisiteOf  []string
+	WantedBy     []string
+	BoundBy      []string
+	ConsistsOf   []string
+	ConflictedBy []string
+	Before       []string
+	After        []string
+	OnFailure    []string
+	Triggers     []string
+	TriggeredBy  []string
+}
+
+// GetUnitDependencies returns the dependencies of a unit, in both directions.
+func (c *Conn) GetUnitDependencies(unit string) (*UnitDependencies, error) {
+	return c.GetUnitDependenciesContext(context.Background(), unit)
+}
+
+// GetUnitDependenciesContext is the same as GetUnitDependencies, but stops
+// waiting for systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) GetUnitDependenciesContext(ctx context.Context, unit string) (*UnitDependencies, error) {
+	props, err := c.getProperties(ctx, unit, "org.freedesktop.systemd1.Unit")
+	if err != nil {
+		return nil, err
+	}
+
+	// Properties missing from older systemd versions are left empty
+	units := func(name string) []string {
+		u, _ := props[name].([]string)
+		return u
+	}
+
+	return &UnitDependencies{
+		Requires:     units("Requires"),
+		Requisite:    units("Requisite"),
+		Wants:        units("Wants"),
+		BindsTo:      units("BindsTo"),
+		PartOf:       units("PartOf"),
+		Conflicts:    units("Conflicts"),
+		RequiredBy:   units("RequiredBy"),
+		RequisiteOf:  units("RequisiteOf"),
+		WantedBy:     units("WantedBy"),
+		BoundBy:      units("BoundBy"),
+		ConsistsOf:   units("ConsistsOf"),
+		ConflictedBy: units("ConflictedBy"),
+		Before:       units("Before"),
+		After:        units("After"),
+		OnFailure:    units("OnFailure"),
+		Triggers:     units("Triggers"),
+		TriggeredBy:  units("TriggeredBy"),
+	}, nil
+}
+
 func (c *Conn) GetUnitProperty(unit string, propertyName string) (*Property, error) {
-	return c.getProperty(unit, "org.freedesktop.systemd1.Unit", propertyName)
+	return c.GetUnitPropertyContext(context.Background(), unit, propertyName)
+}
+
+// GetUnitPropertyContext is the same as GetUnitProperty, but stops waiting for
+// systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) GetUnitPropertyContext(ctx context.Context, unit string, propertyName string) (*Property, error) {
+	return c.getProperty(ctx, unit, "org.freedesktop.systemd1.Unit", propertyName)
 }
 
 // GetUnitTypeProperties returns the extra properties for a unit, specific to the unit type.
 // Valid values for unitType: Service, Socket, Target, Device, Mount, Automount, Snapshot, Timer, Swap, Path, Slice, Scope
 // return "dbus.Error: Unknown interface" if the unitType is not the correct type of the unit
 func (c *Conn) GetUnitTypeProperties(unit string, unitType string) (map[string]interface{}, error) {
-	return c.getProperties(unit, "org.freedesktop.systemd1."+unitType)
+	return c.GetUnitTypePropertiesContext(context.Background(), unit, unitType)
+}
+
+// GetUnitTypePropertiesContext is the same as GetUnitTypeProperties, but stops
+// waiting for systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) GetUnitTypePropertiesContext(ctx context.Context, unit string, unitType string) (map[string]interface{}, error) {
+	return c.getProperties(ctx, unit, "org.freedesktop.systemd1."+unitType)
 }
 
 // SetUnitProperties() may be used to modify certain unit properties at runtime.
@@ -214,11 +558,23 @@ func (c *Conn) GetUnitTypeProperties(unit string, unitType string) (map[string]i
 // to modify. properties are the settings to set, encoded as an array of property
 // name and value pairs.
 func (c *Conn) SetUnitProperties(name string, runtime bool, properties ...Property) error {
-	return c.sysobj.Call("org.freedesktop.systemd1.Manager.SetUnitProperties", 0, name, runtime, properties).Store()
+	return c.SetUnitPropertiesContext(context.Background(), name, runtime, properties...)
+}
+
+// SetUnitPropertiesContext is the same as SetUnitProperties, but stops waiting
+// for systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) SetUnitPropertiesContext(ctx context.Context, name string, runtime bool, properties ...Property) error {
+	return callContext(ctx, c.sysObject(), "org.freedesktop.systemd1.Manager.SetUnitProperties", 0, name, runtime, properties).Store()
 }
 
 func (c *Conn) GetUnitTypeProperty(unit string, unitType string, propertyName string) (*Property, error) {
-	return c.getProperty(unit, "org.freedesktop.systemd1."+unitType, propertyName)
+	return c.GetUnitTypePropertyContext(context.Background(), unit, unitType, propertyName)
+}
+
+// GetUnitTypePropertyContext is the same as GetUnitTypeProperty, but stops
+// waiting for systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) GetUnitTypePropertyContext(ctx context.Context, unit string, unitType string, propertyName string) (*Property, error) {
+	return c.getProperty(ctx, unit, "org.freedesktop.systemd1."+unitType, propertyName)
 }
 
 type UnitStatus struct {
@@ -238,8 +594,34 @@ type UnitStatus struct {
 // units may be known by multiple names at the same time, and hence there might
 // be more unit names loaded than actual units behind them.
 func (c *Conn) ListUnits() ([]UnitStatus, error) {
+	return c.ListUnitsContext(context.Background())
+}
+
+// ListUnitsContext is the same as ListUnits, but stops waiting for systemd and
+// returns ctx.Err() once ctx is done.
+func (c *Conn) ListUnitsContext(ctx context.Context) ([]UnitStatus, error) {
+	return c.listUnits(ctx, "org.freedesktop.systemd1.Manager.ListUnits")
+}
+
+// ListUnitsByNames returns the status of the units with the given names in a
+// single call, loading them if needed, in the same order. Units that do not
+// exist are returned too, with a LoadState of not-found. This requires
+// systemd 230 or later.
+func (c *Conn) ListUnitsByNames(units []string) ([]UnitStatus, error) {
+	return c.ListUnitsByNamesContext(context.Background(), units)
+}
+
+// ListUnitsByNamesContext is the same as ListUnitsByNames, but stops waiting
+// for systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) ListUnitsByNamesContext(ctx context.Context, units []string) ([]UnitStatus, error) {
+	return c.listUnits(ctx, "org.freedesktop.systemd1.Manager.ListUnitsByNames", units)
+}
+
+// listUnits calls a method returning an array of unit statuses, such as
+// ListUnits.
+func (c *Conn) listUnits(ctx context.Context, method string, args ...interface{}) ([]UnitStatus, error) {
 	result := make([][]interface{}, 0)
-	err := c.sysobj.Call("org.freedesktop.systemd1.Manager.ListUnits", 0).Store(&result)
+	err := callContext(ctx, c.sysObject(), method, 0, args...).Store(&result)
 	if err != nil {
 		return nil, err
 	}
@@ -263,15 +645,75 @@ func (c *Conn) ListUnits() ([]UnitStatus, error) {
 	return status, nil
 }
 
+// UnitFile is a unit file on disk, as listed by ListUnitFiles. Type holds
+// the enablement state of the file; see UnitFileStatus for a typed form.
 type UnitFile struct {
 	Path string
 	Type string
 }
 
+// UnitFileState is the enablement state of a unit file, as shown by
+// systemctl list-unit-files.
+type UnitFileState string
+
+const (
+	UnitFileEnabled        UnitFileState = "enabled"
+	UnitFileEnabledRuntime UnitFileState = "enabled-runtime"
+	UnitFileLinked         UnitFileState = "linked"
+	UnitFileLinkedRuntime  UnitFileState = "linked-runtime"
+	UnitFileAlias          UnitFileState = "alias"
+	UnitFileMasked         UnitFileState = "masked"
+	UnitFileMaskedRuntime  UnitFileState = "masked-runtime"
+	UnitFileStatic         UnitFileState = "static"
+	UnitFileDisabled       UnitFileState = "disabled"
+	UnitFileIndirect       UnitFileState = "indirect"
+	UnitFileGenerated      UnitFileState = "generated"
+	UnitFileTransient      UnitFileState = "transient"
+	UnitFileBad            UnitFileState = "bad"
+	UnitFileInvalid        UnitFileState = "invalid"
+)
+
+// ParseUnitFileState returns the UnitFileState named by s, or an error if s is
+// not one of the known states.
+func ParseUnitFileState(s string) (UnitFileState, error) {
+	switch state := UnitFileState(s); state {
+	case UnitFileEnabled, UnitFileEnabledRuntime, UnitFileLinked, UnitFileLinkedRuntime,
+		UnitFileAlias, UnitFileMasked, UnitFileMaskedRuntime, UnitFileStatic, UnitFileDisabled,
+		UnitFileIndirect, UnitFileGenerated, UnitFileTransient, UnitFileBad, UnitFileInvalid:
+		return state, nil
+	}
+	return "", errors.New("unknown unit file state: " + s)
+}
+
+// Enabled reports whether the state is one of those systemctl is-enabled
+// reports as enabled, i.e. enabled or enabled-runtime.
+func (s UnitFileState) Enabled() bool {
+	return s == UnitFileEnabled || s == UnitFileEnabledRuntime
+}
+
+// UnitFileStatus is the typed form of a UnitFile.
+type UnitFileStatus struct {
+	Name  string // The unit name, e.g. sshd.service
+	Path  string // The path of the unit file
+	State UnitFileState
+}
+
+// Status returns the typed form of f. States unknown to ParseUnitFileState,
+// e.g. introduced by newer versions of systemd, are kept as is.
+func (f UnitFile) Status() UnitFileStatus {
+	return UnitFileStatus{Name: path.Base(f.Path), Path: f.Path, State: UnitFileState(f.Type)}
+}
+
 // ListUnitFiles returns an array of all available units on disk.
 func (c *Conn) ListUnitFiles() ([]UnitFile, error) {
+	return c.ListUnitFilesContext(context.Background())
+}
+
+// ListUnitFilesContext is the same as ListUnitFiles, but stops waiting for
+// systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) ListUnitFilesContext(ctx context.Context) ([]UnitFile, error) {
 	result := make([][]interface{}, 0)
-	err := c.sysobj.Call("org.freedesktop.systemd1.Manager.ListUnitFiles", 0).Store(&result)
+	err := callContext(ctx, c.sysObject(), "org.freedesktop.systemd1.Manager.ListUnitFiles", 0).Store(&result)
 	if err != nil {
 		return nil, err
 	}
@@ -295,6 +737,45 @@ func (c *Conn) ListUnitFiles() ([]UnitFile, error) {
 	return files, nil
 }
 
+// ListUnitFilesByState works like ListUnitFiles, but returns the typed
+// status of the unit files in one of the given states, e.g. UnitFileEnabled.
+// If no state is given, all unit files are returned.
+func (c *Conn) ListUnitFilesByState(states ...UnitFileState) ([]UnitFileStatus, error) {
+	return c.ListUnitFilesByStateContext(context.Background(), states...)
+}
+
+// ListUnitFilesByStateContext is the same as ListUnitFilesByState, but stops
+// waiting for systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) ListUnitFilesByStateContext(ctx context.Context, states ...UnitFileState) ([]UnitFileStatus, error) {
+	files, err := c.ListUnitFilesContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return filterUnitFiles(files, states), nil
+}
+
+// filterUnitFiles returns the status of the files in one of states, or of all
+// files if states is empty.
+func filterUnitFiles(files []UnitFile, states []UnitFileState) []UnitFileStatus {
+	statuses := make([]UnitFileStatus, 0, len(files))
+	for _, f := range files {
+		status := f.Status()
+		if len(states) == 0 || hasUnitFileState(states, status.State) {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+func hasUnitFileState(states []UnitFileState, state UnitFileState) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
 type LinkUnitFileChange EnableUnitFileChange
 
 // LinkUnitFiles() links unit files (that are located outside of the
@@ -312,8 +793,14 @@ type LinkUnitFileChange EnableUnitFileChange
 // or unlink), the file name of the symlink and the destination of the
 // symlink.
 func (c *Conn) LinkUnitFiles(files []string, runtime bool, force bool) ([]LinkUnitFileChange, error) {
+	return c.LinkUnitFilesContext(context.Background(), files, runtime, force)
+}
+
+// LinkUnitFilesContext is the same as LinkUnitFiles, but stops waiting for
+// systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) LinkUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) ([]LinkUnitFileChange, error) {
 	result := make([][]interface{}, 0)
-	err := c.sysobj.Call("org.freedesktop.systemd1.Manager.LinkUnitFiles", 0, files, runtime, force).Store(&result)
+	err := callContext(ctx, c.sysObject(), "org.freedesktop.systemd1.Manager.LinkUnitFiles", 0, files, runtime, force).Store(&result)
 	if err != nil {
 		return nil, err
 	}
@@ -353,11 +840,20 @@ func (c *Conn) LinkUnitFiles(files []string, runtime bool, force bool) ([]LinkUn
 // structures with three strings: the type of the change (one of symlink
 // or unlink), the file name of the symlink and the destination of the
 // symlink.
+//
+// As with systemctl enable, Reload must be called afterwards for systemd to
+// take the new symlinks into account, unless the changes list is empty.
 func (c *Conn) EnableUnitFiles(files []string, runtime bool, force bool) (bool, []EnableUnitFileChange, error) {
+	return c.EnableUnitFilesContext(context.Background(), files, runtime, force)
+}
+
+// EnableUnitFilesContext is the same as EnableUnitFiles, but stops waiting for
+// systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) EnableUnitFilesContext(ctx context.Context, files []string, runtime bool, force bool) (bool, []EnableUnitFileChange, error) {
 	var carries_install_info bool
 
 	result := make([][]interface{}, 0)
-	err := c.sysobj.Call("org.freedesktop.systemd1.Manager.EnableUnitFiles", 0, files, runtime, force).Store(&carries_install_info, &result)
+	err := callContext(ctx, c.sysObject(), "org.freedesktop.systemd1.Manager.EnableUnitFiles", 0, files, runtime, force).Store(&carries_install_info, &result)
 	if err != nil {
 		return false, nil, err
 	}
@@ -399,9 +895,18 @@ type EnableUnitFileChange struct {
 // consists of structures with three strings: the type of the change (one of
 // symlink or unlink), the file name of the symlink and the destination of the
 // symlink.
+//
+// As with systemctl disable, Reload must be called afterwards for systemd to
+// take the removed symlinks into account, unless the changes list is empty.
 func (c *Conn) DisableUnitFiles(files []string, runtime bool) ([]DisableUnitFileChange, error) {
+	return c.DisableUnitFilesContext(context.Background(), files, runtime)
+}
+
+// DisableUnitFilesContext is the same as DisableUnitFiles, but stops waiting
+// for systemd and returns ctx.Err() once ctx is done.
+func (c *Conn) DisableUnitFilesContext(ctx context.Context, files []string, runtime bool) ([]DisableUnitFileChange, error) {
 	result := make([][]interface{}, 0)
-	err := c.sysobj.Call("org.freedesktop.systemd1.Manager.DisableUnitFiles", 0, files, runtime).Store(&result)
+	err := callContext(ctx, c.sysObject(), "org.freedesktop.systemd1.Manager.DisableUnitFiles", 0, files, runtime).Store(&result)
 	if err != nil {
 		return nil, err
 	}
@@ -434,7 +939,13 @@ type DisableUnitFileChange struct {
 // Reload instructs systemd to scan for and reload unit files. This is
 // equivalent to a 'systemctl daemon-reload'.
 func (c *Conn) Reload() error {
-	return c.sysobj.Call("org.freedesktop.systemd1.Manager.Reload", 0).Store()
+	return c.ReloadContext(context.Background())
+}
+
+// ReloadContext is the same as Reload, but stops waiting for systemd and
+// returns ctx.Err() once ctx is done.
+func (c *Conn) ReloadContext(ctx context.Context) error {
+	return callContext(ctx, c.sysObject(), "org.freedesktop.systemd1.Manager.Reload", 0).Store()
 }
 
 func unitPath(name string) dbus.ObjectPath {
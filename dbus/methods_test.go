@@ -20,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/godbus/dbus"
@@ -130,6 +131,49 @@ func TestStartStopUnit(t *testing.T) {
 	}
 }
 
+// Ensure that a running unit can be frozen and thawed.
+func TestFreezeThawUnit(t *testing.T) {
+	target := "start-stop.service"
+	conn := setupConn(t)
+
+	setupUnit(target, conn, t)
+	linkUnit(target, conn, t)
+
+	reschan := make(chan string)
+	if _, err := conn.StartUnit(target, "replace", reschan); err != nil {
+		t.Fatal(err)
+	}
+	if job := <-reschan; job != "done" {
+		t.Fatal("Job is not done:", job)
+	}
+	defer func() {
+		conn.StopUnit(target, "replace", reschan)
+		<-reschan
+	}()
+
+	if err := conn.FreezeUnit(target); err != nil {
+		t.Skipf("Cannot freeze units: %v", err)
+	}
+	props, err := conn.GetUnitProperties(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := props["FreezerState"]; state != "frozen" && state != "freezing" {
+		t.Fatalf("Expected unit to be frozen, got %v", state)
+	}
+
+	if err := conn.ThawUnit(target); err != nil {
+		t.Fatal(err)
+	}
+	props, err = conn.GetUnitProperties(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state := props["FreezerState"]; state != "running" && state != "thawing" {
+		t.Fatalf("Expected unit to be thawed, got %v", state)
+	}
+}
+
 // Enables a unit and then immediately tears it down
 func TestEnableDisableUnit(t *testing.T) {
 	target := "enable-disable.service"
@@ -211,6 +255,98 @@ func TestGetUnitProperties(t *testing.T) {
 	}
 }
 
+// TestGetUnitPropertiesByName ensures that only the requested properties are
+// returned, with the same values as GetUnitProperties.
+func TestGetUnitPropertiesByName(t *testing.T) {
+	conn := setupConn(t)
+
+	unit := "-.mount"
+
+	info, err := conn.GetUnitProperties(unit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	props, err := conn.GetUnitPropertiesByName(unit, "ActiveState", "Wants")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(props) != 2 {
+		t.Fatalf("Expected 2 properties, got %v", props)
+	}
+	for _, name := range []string{"ActiveState", "Wants"} {
+		if !reflect.DeepEqual(props[name], info[name]) {
+			t.Fatalf("Unexpected value for %s: %v", name, props[name])
+		}
+	}
+}
+
+// TestListUnitsByNames ensures that both existing and missing units are
+// returned, in the requested order.
+func TestListUnitsByNames(t *testing.T) {
+	conn := setupConn(t)
+
+	names := []string{"-.mount", "go-systemd-nonexistent.service"}
+	units, err := conn.ListUnitsByNames(names)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(units) != len(names) {
+		t.Fatalf("Expected %d units, got %d", len(names), len(units))
+	}
+	for i, u := range units {
+		if u.Name != names[i] {
+			t.Fatalf("Expected unit %s, got %s", names[i], u.Name)
+		}
+	}
+	if units[0].LoadState != "loaded" || units[1].LoadState != "not-found" {
+		t.Fatalf("Unexpected load states %s and %s", units[0].LoadState, units[1].LoadState)
+	}
+}
+
+// TestResetFailedUnitNotLoaded ensures that resetting a unit which is not
+// loaded fails with the NoSuchUnit error of systemd, naming it.
+func TestResetFailedUnitNotLoaded(t *testing.T) {
+	conn := setupConn(t)
+
+	unit := "go-systemd-nonexistent.service"
+	err := conn.ResetFailedUnit(unit)
+	if e, ok := err.(dbus.Error); !ok || e.Name != "org.freedesktop.systemd1.NoSuchUnit" || !strings.Contains(e.Error(), unit) {
+		t.Fatalf("Expected a NoSuchUnit error for a unit not loaded, got %v", err)
+	}
+
+	if err := conn.ResetFailed(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestGetUnitDependencies ensures that the dependencies of a unit match its
+// raw properties.
+func TestGetUnitDependencies(t *testing.T) {
+	conn := setupConn(t)
+
+	unit := "-.mount"
+
+	info, err := conn.GetUnitProperties(unit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deps, err := conn.GetUnitDependencies(unit)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(deps.Wants, info["Wants"]) {
+		t.Fatalf("Unexpected Wants: %v", deps.Wants)
+	}
+	if !reflect.DeepEqual(deps.Before, info["Before"]) {
+		t.Fatalf("Unexpected Before: %v", deps.Before)
+	}
+}
+
 // TestGetUnitPropertiesRejectsInvalidName attempts to get the properties for a
 // unit with an invalid name. This test should be run with --test.timeout set,
 // as a fail will manifest as GetUnitProperties hanging indefinitely.
@@ -230,6 +366,18 @@ func TestGetUnitPropertiesRejectsInvalidName(t *testing.T) {
 	}
 }
 
+// TestKillUnitWithTargetRejectsInvalidTarget ensures kill targets are
+// validated before calling systemd.
+func TestKillUnitWithTargetRejectsInvalidTarget(t *testing.T) {
+	conn := &Conn{}
+
+	for _, who := range []string{"", "everything", "Main"} {
+		if err := conn.KillUnitWithTarget("foo.service", who, 9); err == nil {
+			t.Errorf("Expected an error for target %q", who)
+		}
+	}
+}
+
 // TestSetUnitProperties changes a cgroup setting on the `tmp.mount`
 // which should exist on all systemd systems and ensures that the
 // property was set.
@@ -314,6 +462,101 @@ func TestStartStopTransientUnit(t *testing.T) {
 	}
 }
 
+// TestJobComplete ensures that JobRemoved signals are reported both to the
+// listener of the job and to the job subscriber.
+func TestJobComplete(t *testing.T) {
+	conn := &Conn{}
+	conn.jobListener.jobs = make(map[dbus.ObjectPath]chan<- string)
+
+	job := dbus.ObjectPath("/org/freedesktop/systemd1/job/42")
+	resCh := make(chan string, 1)
+	conn.jobListener.jobs[job] = resCh
+	removedCh := make(chan *JobRemoved, 1)
+	conn.SetJobRemovedSubscriber(removedCh)
+
+	conn.jobComplete(&dbus.Signal{
+		Name: "org.freedesktop.systemd1.Manager.JobRemoved",
+		Body: []interface{}{uint32(42), job, "foo.service", "failed"},
+	})
+
+	if res := <-resCh; res != "failed" {
+		t.Fatalf("Unexpected job result: %s", res)
+	}
+	if removed := <-removedCh; *removed != (JobRemoved{42, job, "foo.service", "failed"}) {
+		t.Fatalf("Unexpected removed job: %v", removed)
+	}
+	if _, ok := conn.jobListener.jobs[job]; ok {
+		t.Fatal("Job listener not removed")
+	}
+}
+
+func TestUnitFileStatus(t *testing.T) {
+	files := []UnitFile{
+		{Path: "/usr/lib/systemd/system/sshd.service", Type: "enabled"},
+		{Path: "/etc/systemd/system/foo.service", Type: "masked"},
+		{Path: "/run/systemd/system/bar.service", Type: "enabled-runtime"},
+		{Path: "/usr/lib/systemd/system/baz.timer", Type: "some-future-state"},
+	}
+
+	statuses := filterUnitFiles(files, nil)
+	if len(statuses) != len(files) {
+		t.Fatalf("Expected %d unit files, got %d", len(files), len(statuses))
+	}
+	expected := UnitFileStatus{Name: "sshd.service", Path: "/usr/lib/systemd/system/sshd.service", State: UnitFileEnabled}
+	if statuses[0] != expected {
+		t.Errorf("Expected %+v, got %+v", expected, statuses[0])
+	}
+	if statuses[3].State != "some-future-state" {
+		t.Errorf("Expected unknown states to be kept, got %q", statuses[3].State)
+	}
+
+	enabled := filterUnitFiles(files, []UnitFileState{UnitFileEnabled, UnitFileEnabledRuntime})
+	if len(enabled) != 2 || enabled[0].Name != "sshd.service" || enabled[1].Name != "bar.service" {
+		t.Errorf("Unexpected enabled unit files: %+v", enabled)
+	}
+	for _, s := range enabled {
+		if !s.State.Enabled() {
+			t.Errorf("Expected %s to be enabled", s.Name)
+		}
+	}
+	if UnitFileMasked.Enabled() {
+		t.Errorf("Expected masked not to be enabled")
+	}
+
+	if state, err := ParseUnitFileState("static"); err != nil || state != UnitFileStatic {
+		t.Errorf("Unexpected state %q: %v", state, err)
+	}
+	if _, err := ParseUnitFileState("some-future-state"); err == nil {
+		t.Errorf("Expected an error for an unknown state")
+	}
+}
+
+func TestTransientUnitOptionsProperties(t *testing.T) {
+	opts := &TransientUnitOptions{
+		Description: "test unit",
+		ExecStart:   []string{"/bin/sleep", "400"},
+		Type:        "simple",
+		MemoryMax:   64 << 20,
+		CPUQuota:    50,
+		Environment: []string{"FOO=bar"},
+		Properties:  []Property{PropRemainAfterExit(true)},
+	}
+
+	expected := []Property{
+		PropDescription("test unit"),
+		PropExecStart([]string{"/bin/sleep", "400"}, false),
+		PropType("simple"),
+		PropMemoryMax(64 << 20),
+		{Name: "CPUQuotaPerSecUSec", Value: dbus.MakeVariant(uint64(500000))},
+		PropEnvironment("FOO=bar"),
+		PropRemainAfterExit(true),
+	}
+
+	if props := opts.properties(); !reflect.DeepEqual(props, expected) {
+		t.Fatalf("Expected properties %v, got %v", expected, props)
+	}
+}
+
 func TestConnJobListener(t *testing.T) {
 	target := "start-stop.service"
 	conn := setupConn(t)
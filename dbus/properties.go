@@ -216,3 +216,86 @@ func PropSlice(slice string) Property {
 		Value: dbus.MakeVariant(slice),
 	}
 }
+
+// PropType sets the Type service property.  See
+// http://www.freedesktop.org/software/systemd/man/systemd.service.html#Type=
+func PropType(t string) Property {
+	return Property{
+		Name:  "Type",
+		Value: dbus.MakeVariant(t),
+	}
+}
+
+// PropEnvironment sets the Environment unit property, from variable
+// assignments of the form KEY=value.  See
+// http://www.freedesktop.org/software/systemd/man/systemd.exec.html#Environment=
+func PropEnvironment(env ...string) Property {
+	return Property{
+		Name:  "Environment",
+		Value: dbus.MakeVariant(env),
+	}
+}
+
+// PropMemoryMax sets the MemoryMax unit property, in bytes.  See
+// http://www.freedesktop.org/software/systemd/man/systemd.resource-control.html#MemoryMax=bytes
+func PropMemoryMax(bytes uint64) Property {
+	return Property{
+		Name:  "MemoryMax",
+		Value: dbus.MakeVariant(bytes),
+	}
+}
+
+// PropCPUQuota sets the CPUQuota unit property, as a percentage of the time of
+// a single CPU, e.g. 200 for two full CPUs.  See
+// http://www.freedesktop.org/software/systemd/man/systemd.resource-control.html#CPUQuota=
+func PropCPUQuota(percent uint64) Property {
+	// systemd exposes the quota as the CPU time allowed per second of
+	// wall-clock time, in microseconds
+	return Property{
+		Name:  "CPUQuotaPerSecUSec",
+		Value: dbus.MakeVariant(percent * 10000),
+	}
+}
+
+// TransientUnitOptions holds the commonly used settings of a transient unit,
+// from which StartTransientUnitWithOptions builds the unit properties. Fields
+// left to their zero value are not set.
+type TransientUnitOptions struct {
+	Description string   // See PropDescription
+	ExecStart   []string // Binary path followed by its arguments, see PropExecStart
+	Type        string   // Service type, e.g. simple or oneshot, see PropType
+	Slice       string   // See PropSlice
+	MemoryMax   uint64   // Memory limit in bytes, see PropMemoryMax
+	CPUQuota    uint64   // CPU quota in percent, see PropCPUQuota
+	Environment []string // Variable assignments of the form KEY=value, see PropEnvironment
+
+	// Properties not covered by the fields above, added as is
+	Properties []Property
+}
+
+// properties returns the unit properties described by the options.
+func (o *TransientUnitOptions) properties() []Property {
+	var props []Property
+	if o.Description != "" {
+		props = append(props, PropDescription(o.Description))
+	}
+	if len(o.ExecStart) > 0 {
+		props = append(props, PropExecStart(o.ExecStart, false))
+	}
+	if o.Type != "" {
+		props = append(props, PropType(o.Type))
+	}
+	if o.Slice != "" {
+		props = append(props, PropSlice(o.Slice))
+	}
+	if o.MemoryMax != 0 {
+		props = append(props, PropMemoryMax(o.MemoryMax))
+	}
+	if o.CPUQuota != 0 {
+		props = append(props, PropCPUQuota(o.CPUQuota))
+	}
+	if len(o.Environment) > 0 {
+		props = append(props, PropEnvironment(o.Environment...))
+	}
+	return append(props, o.Properties...)
+}
@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"github.com/godbus/dbus"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -31,38 +32,62 @@ const (
 // systemd will automatically stop sending signals so there is no need to
 // explicitly call Unsubscribe().
 func (c *Conn) Subscribe() error {
-	c.sigconn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0,
+	return c.SubscribeContext(context.Background())
+}
+
+// SubscribeContext is the same as Subscribe, but stops waiting for systemd and
+// returns ctx.Err() once ctx is done.
+func (c *Conn) SubscribeContext(ctx context.Context) error {
+	c.sigConn().BusObject().Call("org.freedesktop.DBus.AddMatch", 0,
 		"type='signal',interface='org.freedesktop.systemd1.Manager',member='UnitNew'")
-	c.sigconn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0,
+	c.sigConn().BusObject().Call("org.freedesktop.DBus.AddMatch", 0,
 		"type='signal',interface='org.freedesktop.DBus.Properties',member='PropertiesChanged'")
 
-	err := c.sigobj.Call("org.freedesktop.systemd1.Manager.Subscribe", 0).Store()
+	err := callContext(ctx, c.sigObject(), "org.freedesktop.systemd1.Manager.Subscribe", 0).Store()
 	if err != nil {
 		return err
 	}
 
+	c.subscriber.Lock()
+	c.subscriber.subscribed = true
+	c.subscriber.Unlock()
+
 	return nil
 }
 
 // Unsubscribe this connection from systemd dbus events.
 func (c *Conn) Unsubscribe() error {
-	err := c.sigobj.Call("org.freedesktop.systemd1.Manager.Unsubscribe", 0).Store()
+	return c.UnsubscribeContext(context.Background())
+}
+
+// UnsubscribeContext is the same as Unsubscribe, but stops waiting for systemd
+// and returns ctx.Err() once ctx is done.
+func (c *Conn) UnsubscribeContext(ctx context.Context) error {
+	err := callContext(ctx, c.sigObject(), "org.freedesktop.systemd1.Manager.Unsubscribe", 0).Store()
 	if err != nil {
 		return err
 	}
 
+	c.subscriber.Lock()
+	c.subscriber.subscribed = false
+	c.subscriber.Unlock()
+
 	return nil
 }
 
-func (c *Conn) dispatch() {
+// dispatch handles the signals received on sigconn, closing lost once the
+// connection is gone.
+func (c *Conn) dispatch(sigconn *dbus.Conn, lost chan struct{}) {
 	ch := make(chan *dbus.Signal, signalBuffer)
 
-	c.sigconn.Signal(ch)
+	sigconn.Signal(ch)
 
 	go func() {
 		for {
 			signal, ok := <-ch
 			if !ok {
+				// godbus closes the signal channels along with the connection
+				close(lost)
 				return
 			}
 
@@ -70,6 +95,10 @@ func (c *Conn) dispatch() {
 				c.jobComplete(signal)
 			}
 
+			if signal.Name == "org.freedesktop.DBus.Properties.PropertiesChanged" {
+				c.sendUnitStateUpdate(signal)
+			}
+
 			if c.subscriber.updateCh == nil {
 				continue
 			}
@@ -78,7 +107,7 @@ func (c *Conn) dispatch() {
 			switch signal.Name {
 			case "org.freedesktop.systemd1.Manager.JobRemoved":
 				unitName := signal.Body[2].(string)
-				c.sysobj.Call("org.freedesktop.systemd1.Manager.GetUnit", 0, unitName).Store(&unitPath)
+				c.sysObject().Call("org.freedesktop.systemd1.Manager.GetUnit", 0, unitName).Store(&unitPath)
 			case "org.freedesktop.systemd1.Manager.UnitNew":
 				unitPath = signal.Body[1].(dbus.ObjectPath)
 			case "org.freedesktop.DBus.Properties.PropertiesChanged":
@@ -207,6 +236,110 @@ func (c *Conn) sendSubStateUpdate(path dbus.ObjectPath) {
 	c.updateIgnore(path, info)
 }
 
+// UnitStateUpdate is a change in the state of a unit subscribed to with
+// SubscribeUnitState. ActiveState and SubState are empty when they were not
+// part of the change.
+type UnitStateUpdate struct {
+	UnitName    string
+	ActiveState string
+	SubState    string
+}
+
+type unitSubscription struct {
+	name string
+	ch   chan<- *UnitStateUpdate
+}
+
+// SubscribeUnitState writes to ch whenever the active state or sub state of
+// the given unit changes, as reported by the PropertiesChanged signals of the
+// unit object, so that units can be watched without polling ListUnits.
+// Subscribe must be called first, as systemd only sends these signals to
+// subscribed clients. As with SetSubStateSubscriber, updates are written with
+// non-blocking writes, and dropped if ch is full. The same channel may be
+// used for several units.
+func (c *Conn) SubscribeUnitState(unit string, ch chan<- *UnitStateUpdate) error {
+	path := unitPath(unit)
+	if !path.IsValid() {
+		return errors.New("invalid unit name: " + unit)
+	}
+
+	c.unitSubscriber.Lock()
+	defer c.unitSubscriber.Unlock()
+
+	if len(c.unitSubscriber.units[path]) == 0 {
+		err := c.sigConn().BusObject().Call("org.freedesktop.DBus.AddMatch", 0, unitStateMatch(path)).Store()
+		if err != nil {
+			return err
+		}
+	}
+	c.unitSubscriber.units[path] = append(c.unitSubscriber.units[path], unitSubscription{unit, ch})
+
+	return nil
+}
+
+// UnsubscribeUnitState stops writing the state changes of the given unit to
+// ch. It fails if ch was not subscribed to the unit with SubscribeUnitState.
+func (c *Conn) UnsubscribeUnitState(unit string, ch chan<- *UnitStateUpdate) error {
+	path := unitPath(unit)
+
+	c.unitSubscriber.Lock()
+	defer c.unitSubscriber.Unlock()
+
+	subs := c.unitSubscriber.units[path]
+	found := false
+	for i, sub := range subs {
+		if sub.ch == ch {
+			subs = append(subs[:i], subs[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errors.New("channel not subscribed to the state of unit: " + unit)
+	}
+
+	if len(subs) > 0 {
+		c.unitSubscriber.units[path] = subs
+		return nil
+	}
+
+	delete(c.unitSubscriber.units, path)
+	return c.sigConn().BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, unitStateMatch(path)).Store()
+}
+
+func unitStateMatch(path dbus.ObjectPath) string {
+	return "type='signal',interface='org.freedesktop.DBus.Properties',member='PropertiesChanged',path='" + string(path) + "'"
+}
+
+func (c *Conn) sendUnitStateUpdate(signal *dbus.Signal) {
+	var iface string
+	var changed map[string]dbus.Variant
+	var invalidated []string
+	if err := dbus.Store(signal.Body, &iface, &changed, &invalidated); err != nil {
+		return
+	}
+	if iface != "org.freedesktop.systemd1.Unit" {
+		return
+	}
+
+	activeState, _ := changed["ActiveState"].Value().(string)
+	subState, _ := changed["SubState"].Value().(string)
+	if activeState == "" && subState == "" {
+		return
+	}
+
+	c.unitSubscriber.Lock()
+	defer c.unitSubscriber.Unlock()
+
+	for _, sub := range c.unitSubscriber.units[signal.Path] {
+		update := &UnitStateUpdate{sub.name, activeState, subState}
+		select {
+		case sub.ch <- update:
+		default:
+		}
+	}
+}
+
 // The ignore functions work around a wart in the systemd dbus interface.
 // Requesting the properties of an unloaded unit will cause systemd to send a
 // pair of UnitNew/UnitRemoved signals.  Because we need to get a unit's
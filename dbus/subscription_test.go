@@ -17,6 +17,8 @@ package dbus
 import (
 	"testing"
 	"time"
+
+	"github.com/godbus/dbus"
 )
 
 // TestSubscribe exercises the basics of subscription
@@ -103,3 +105,72 @@ func TestSubscribeUnit(t *testing.T) {
 success:
 	return
 }
+
+// TestUnsubscribeUnitStateNotSubscribed ensures that unsubscribing a channel
+// which is not subscribed to a unit fails, and leaves the other subscribers,
+// and the match rule, in place.
+func TestUnsubscribeUnitStateNotSubscribed(t *testing.T) {
+	// Without connections, removing the match rule would panic
+	conn := &Conn{}
+	conn.unitSubscriber.units = make(map[dbus.ObjectPath][]unitSubscription)
+
+	ch := make(chan *UnitStateUpdate, 1)
+	other := make(chan *UnitStateUpdate, 1)
+	path := unitPath("foo.service")
+	conn.unitSubscriber.units[path] = []unitSubscription{{"foo.service", ch}}
+
+	if err := conn.UnsubscribeUnitState("bar.service", ch); err == nil {
+		t.Error("Expected an error for a unit not subscribed to")
+	}
+	if err := conn.UnsubscribeUnitState("foo.service", other); err == nil {
+		t.Error("Expected an error for a channel not subscribed")
+	}
+
+	if subs := conn.unitSubscriber.units[path]; len(subs) != 1 || subs[0].ch != ch {
+		t.Fatalf("Unexpected subscribers: %v", subs)
+	}
+}
+
+// TestSendUnitStateUpdate ensures that PropertiesChanged signals of a unit are
+// turned into updates for its subscribers only.
+func TestSendUnitStateUpdate(t *testing.T) {
+	conn := &Conn{}
+	conn.unitSubscriber.units = make(map[dbus.ObjectPath][]unitSubscription)
+
+	ch := make(chan *UnitStateUpdate, 1)
+	path := unitPath("foo.service")
+	conn.unitSubscriber.units[path] = []unitSubscription{{"foo.service", ch}}
+
+	signal := func(path dbus.ObjectPath, iface string) *dbus.Signal {
+		return &dbus.Signal{
+			Path: path,
+			Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+			Body: []interface{}{
+				iface,
+				map[string]dbus.Variant{
+					"ActiveState": dbus.MakeVariant("active"),
+					"SubState":    dbus.MakeVariant("running"),
+				},
+				[]string{},
+			},
+		}
+	}
+
+	conn.sendUnitStateUpdate(signal(unitPath("bar.service"), "org.freedesktop.systemd1.Unit"))
+	conn.sendUnitStateUpdate(signal(path, "org.freedesktop.systemd1.Service"))
+	select {
+	case update := <-ch:
+		t.Fatalf("Unexpected update: %v", update)
+	default:
+	}
+
+	conn.sendUnitStateUpdate(signal(path, "org.freedesktop.systemd1.Unit"))
+	select {
+	case update := <-ch:
+		if *update != (UnitStateUpdate{"foo.service", "active", "running"}) {
+			t.Fatalf("Unexpected update: %v", update)
+		}
+	default:
+		t.Fatal("Expected an update")
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"errors"
+	"io"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/godbus/dbus"
+)
+
+// execConn is a connection to a process spawned for a unixexec: address,
+// speaking dbus over its standard input and output.
+type execConn struct {
+	io.WriteCloser // standard input of the process
+	io.Reader      // standard output of the process
+	cmd            *exec.Cmd
+}
+
+func (c *execConn) Close() error {
+	err := c.WriteCloser.Close()
+	c.cmd.Process.Kill()
+	c.cmd.Wait()
+	return err
+}
+
+// parseUnixExec returns the command line of a unixexec: address, made of its
+// path and argvN keys, argv0 defaulting to the path. Values are unescaped as
+// per the dbus specification.
+func parseUnixExec(address string) (string, []string, error) {
+	var path string
+	argv := make(map[int]string)
+
+	for _, kv := range strings.Split(strings.TrimPrefix(address, "unixexec:"), ",") {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 {
+			return "", nil, errors.New("dbus: invalid unixexec address " + address)
+		}
+		value, err := unescapeAddressValue(kv[i+1:])
+		if err != nil {
+			return "", nil, err
+		}
+
+		switch key := kv[:i]; {
+		case key == "path":
+			path = value
+		case strings.HasPrefix(key, "argv"):
+			n, err := strconv.Atoi(key[len("argv"):])
+			if err != nil || n < 0 {
+				return "", nil, errors.New("dbus: invalid unixexec argument " + key)
+			}
+			argv[n] = value
+		}
+	}
+
+	if path == "" {
+		return "", nil, errors.New("dbus: unixexec address without path")
+	}
+	if _, ok := argv[0]; !ok {
+		argv[0] = path
+	}
+
+	indexes := make([]int, 0, len(argv))
+	for n := range argv {
+		indexes = append(indexes, n)
+	}
+	sort.Ints(indexes)
+	for i, n := range indexes {
+		if i != n {
+			return "", nil, errors.New("dbus: missing unixexec argument argv" + strconv.Itoa(i))
+		}
+	}
+
+	args := make([]string, len(indexes))
+	for n, arg := range argv {
+		args[n] = arg
+	}
+	return path, args, nil
+}
+
+// unescapeAddressValue decodes the %XX escapes, XX being two hex digits, of a
+// value of a dbus address. Any other byte stands for itself.
+func unescapeAddressValue(value string) (string, error) {
+	if strings.IndexByte(value, '%') < 0 {
+		return value, nil
+	}
+
+	b := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] != '%' {
+			b = append(b, value[i])
+			continue
+		}
+		if i+2 >= len(value) {
+			return "", errors.New("dbus: truncated escape in address value " + value)
+		}
+		n, err := strconv.ParseUint(value[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", errors.New("dbus: invalid escape in address value " + value)
+		}
+		b = append(b, byte(n))
+		i += 2
+	}
+	return string(b), nil
+}
+
+// dialUnixExec spawns the process of a unixexec: address and opens a dbus
+// connection over its standard input and output.
+func dialUnixExec(address string) (*dbus.Conn, error) {
+	path, args, err := parseUnixExec(address)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := &exec.Cmd{Path: path, Args: args}
+	if !strings.ContainsRune(path, '/') {
+		if cmd.Path, err = exec.LookPath(path); err != nil {
+			return nil, err
+		}
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	conn, err := dbus.NewConn(&execConn{stdin, stdout, cmd})
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, err
+	}
+	return conn, nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbus
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseUnixExec(t *testing.T) {
+	path, args, err := parseUnixExec("unixexec:path=ssh,argv2=systemd-stdio-bridge,argv1=user%40host%2c%2Fx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "ssh" {
+		t.Errorf("bad path: got %q, want %q", path, "ssh")
+	}
+	if want := []string{"ssh", "user@host,/x", "systemd-stdio-bridge"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("bad arguments: got %q, want %q", args, want)
+	}
+
+	for _, address := range []string{
+		"unixexec:argv0=ssh",
+		"unixexec:path=ssh,argv2=host",
+		"unixexec:path=ssh,argvx=host",
+		"unixexec:path",
+		"unixexec:path=ssh,argv1=user%4",
+		"unixexec:path=ssh,argv1=user%zzhost",
+	} {
+		if _, _, err := parseUnixExec(address); err == nil {
+			t.Errorf("expected an error for %q", address)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Activation example used by the activation unit tests.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/coreos/go-systemd/activation"
+)
+
+func fixListenPid() {
+	if os.Getenv("FIX_LISTEN_PID") != "" {
+		// HACK: real systemd would set LISTEN_PID before exec'ing but
+		// this is too difficult in golang for the purpose of a test.
+		// Do not do this in real code.
+		os.Setenv("LISTEN_PID", fmt.Sprintf("%d", os.Getpid()))
+	}
+}
+
+func main() {
+	fixListenPid()
+
+	listeners, err := activation.ListenersWithNames(true)
+	if err != nil {
+		panic(err)
+	}
+
+	if os.Getenv("LISTEN_FDNAMES") != "" {
+		panic("Can not unset envs")
+	}
+
+	if len(listeners) != 2 {
+		panic(fmt.Sprintf("Expected 2 names, got %d", len(listeners)))
+	}
+
+	// Write out the name and index of each listener to its connection
+	for _, name := range []string{"web", "LISTEN_FD_4"} {
+		for i, l := range listeners[name] {
+			c, err := l.Accept()
+			if err != nil {
+				panic(err)
+			}
+			c.Write([]byte(fmt.Sprintf("%s %d", name, i)))
+			c.Close()
+		}
+	}
+
+	return
+}
@@ -0,0 +1,270 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Integration with the systemd importd API.  See https://www.freedesktop.org/wiki/Software/systemd/importd/
+package import1
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-systemd/internal/dbusutil"
+	"github.com/godbus/dbus"
+	"golang.org/x/net/context"
+)
+
+const (
+	dbusDest              = "org.freedesktop.import1"
+	dbusInterface         = "org.freedesktop.import1.Manager"
+	dbusTransferInterface = "org.freedesktop.import1.Transfer"
+	dbusPath              = "/org/freedesktop/import1"
+)
+
+// Conn is a connection to systemds dbus endpoint.
+type Conn struct {
+	conn   *dbus.Conn
+	object dbus.BusObject
+
+	transfersLock sync.Mutex
+	transfers     *dbusutil.Subscription
+}
+
+// New() establishes a connection to the system bus and authenticates.
+func New() (*Conn, error) {
+	c := new(Conn)
+
+	if err := c.initConnection(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Conn) initConnection() error {
+	var err error
+	c.conn, err = dbus.SystemBusPrivate()
+	if err != nil {
+		return err
+	}
+
+	// Only use EXTERNAL method, and hardcode the uid (not username)
+	// to avoid a username lookup (which requires a dynamically linked
+	// libc)
+	methods := []dbus.Auth{dbus.AuthExternal(strconv.Itoa(os.Getuid()))}
+
+	err = c.conn.Auth(methods)
+	if err != nil {
+		c.conn.Close()
+		return err
+	}
+
+	err = c.conn.Hello()
+	if err != nil {
+		c.conn.Close()
+		return err
+	}
+
+	c.object = c.conn.Object(dbusDest, dbus.ObjectPath(dbusPath))
+
+	return nil
+}
+
+// Transfer is a download or import running in systemd-importd.
+type Transfer struct {
+	ID   uint32
+	Path dbus.ObjectPath
+}
+
+// PullRaw downloads a raw disk image from url into a machine image named
+// localName. verify is one of "no", "checksum" or "signature".
+func (c *Conn) PullRaw(url, localName, verify string) (*Transfer, error) {
+	return c.pull("PullRaw", url, localName, verify)
+}
+
+// PullTar downloads a tar archive from url into a machine image named
+// localName. verify is one of "no", "checksum" or "signature".
+func (c *Conn) PullTar(url, localName, verify string) (*Transfer, error) {
+	return c.pull("PullTar", url, localName, verify)
+}
+
+func (c *Conn) pull(method, url, localName, verify string) (*Transfer, error) {
+	var t Transfer
+	err := c.object.Call(dbusInterface+"."+method, 0, url, localName, verify, false).Store(&t.ID, &t.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CancelTransfer cancels the transfer with the given id.
+func (c *Conn) CancelTransfer(id uint32) error {
+	return c.object.Call(dbusInterface+".CancelTransfer", 0, id).Err
+}
+
+// TransferProgress returns the progress of t, between 0 and 100 percent.
+func (c *Conn) TransferProgress(t *Transfer) (float64, error) {
+	obj := c.conn.Object(dbusDest, t.Path)
+	v, err := obj.GetProperty(dbusTransferInterface + ".Progress")
+	if err != nil {
+		return 0, err
+	}
+	progress, ok := v.Value().(float64)
+	if !ok {
+		return 0, fmt.Errorf("invalid progress %v", v)
+	}
+	return progress * 100, nil
+}
+
+// WatchTransferProgress reports the progress of t in percent on the
+// returned channel every interval, as importd does not signal changes to
+// it. The channel is closed once the transfer is gone or ctx is done.
+func (c *Conn) WatchTransferProgress(ctx context.Context, t *Transfer, interval time.Duration) <-chan float64 {
+	ch := make(chan float64)
+
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		last := -1.0
+		for {
+			progress, err := c.TransferProgress(t)
+			if err != nil {
+				return
+			}
+			if progress != last {
+				select {
+				case ch <- progress:
+				case <-ctx.Done():
+					return
+				}
+				last = progress
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// TransferEvent reports a transfer being started or finished. Result is
+// only set for finished transfers, and is one of "done", "canceled" or
+// "failed".
+type TransferEvent struct {
+	Transfer
+	Removed bool
+	Result  string
+}
+
+var transferSignals = []string{"TransferNew", "TransferRemoved"}
+
+// SubscribeTransfers delivers an event on the returned channel whenever a
+// transfer is started or finished, until UnsubscribeTransfers is called,
+// which closes the channel. Only one subscription may be active at a time.
+func (c *Conn) SubscribeTransfers() (<-chan TransferEvent, error) {
+	c.transfersLock.Lock()
+	defer c.transfersLock.Unlock()
+
+	if c.transfers != nil {
+		return nil, errors.New("already subscribed to transfers")
+	}
+
+	var matches []string
+	for _, member := range transferSignals {
+		matches = append(matches, dbusutil.SignalMatch(dbusDest, dbusInterface, member))
+	}
+	sub, err := dbusutil.Subscribe(c.conn, matches...)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan TransferEvent, 10)
+	go func() {
+		defer close(events)
+		sub.Dispatch(func(sig *dbus.Signal, done <-chan struct{}) {
+			ev, ok := transferEvent(sig)
+			if !ok {
+				return
+			}
+			select {
+			case events <- ev:
+			case <-done:
+			}
+		})
+	}()
+
+	c.transfers = sub
+	return events, nil
+}
+
+func transferEvent(sig *dbus.Signal) (TransferEvent, bool) {
+	var ev TransferEvent
+
+	switch sig.Name {
+	case dbusInterface + ".TransferNew":
+	case dbusInterface + ".TransferRemoved":
+		ev.Removed = true
+		if len(sig.Body) < 3 {
+			return ev, false
+		}
+		result, ok := sig.Body[2].(string)
+		if !ok {
+			return ev, false
+		}
+		ev.Result = result
+	default:
+		return ev, false
+	}
+
+	if len(sig.Body) < 2 {
+		return ev, false
+	}
+	id, ok := sig.Body[0].(uint32)
+	if !ok {
+		return ev, false
+	}
+	path, ok := sig.Body[1].(dbus.ObjectPath)
+	if !ok {
+		return ev, false
+	}
+
+	ev.ID = id
+	ev.Path = path
+	return ev, true
+}
+
+// UnsubscribeTransfers stops the subscription started by
+// SubscribeTransfers and removes its dbus matches.
+func (c *Conn) UnsubscribeTransfers() error {
+	c.transfersLock.Lock()
+	defer c.transfersLock.Unlock()
+
+	sub := c.transfers
+	if sub == nil {
+		return errors.New("not subscribed to transfers")
+	}
+	c.transfers = nil
+
+	return sub.Unsubscribe()
+}
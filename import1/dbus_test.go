@@ -0,0 +1,72 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package import1
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus"
+)
+
+// TestNew ensures that New() works without errors.
+func TestNew(t *testing.T) {
+	_, err := New()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransferEvent(t *testing.T) {
+	path := dbus.ObjectPath("/org/freedesktop/import1/transfer/_1")
+
+	tests := []struct {
+		sig *dbus.Signal
+		ev  TransferEvent
+		ok  bool
+	}{
+		{
+			&dbus.Signal{Name: dbusInterface + ".TransferNew", Body: []interface{}{uint32(1), path}},
+			TransferEvent{Transfer: Transfer{ID: 1, Path: path}},
+			true,
+		},
+		{
+			&dbus.Signal{Name: dbusInterface + ".TransferRemoved", Body: []interface{}{uint32(1), path, "done"}},
+			TransferEvent{Transfer: Transfer{ID: 1, Path: path}, Removed: true, Result: "done"},
+			true,
+		},
+		{
+			&dbus.Signal{Name: dbusInterface + ".TransferRemoved", Body: []interface{}{uint32(1), path}},
+			TransferEvent{},
+			false,
+		},
+		{
+			&dbus.Signal{Name: "org.freedesktop.DBus.NameAcquired", Body: []interface{}{":1.1"}},
+			TransferEvent{},
+			false,
+		},
+	}
+
+	for i, tt := range tests {
+		ev, ok := transferEvent(tt.sig)
+		if ok != tt.ok {
+			t.Errorf("case %d: expected ok=%v, got %v", i, tt.ok, ok)
+			continue
+		}
+		if ok && ev != tt.ev {
+			t.Errorf("case %d: expected %+v, got %+v", i, tt.ev, ev)
+		}
+	}
+}
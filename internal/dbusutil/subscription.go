@@ -0,0 +1,109 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dbusutil holds helpers shared by the dbus bindings of the systemd
+// daemons.
+package dbusutil
+
+import (
+	"fmt"
+
+	"github.com/godbus/dbus"
+)
+
+// Subscription delivers the signals selected by a set of match rules, until
+// it is stopped with Unsubscribe.
+type Subscription struct {
+	conn    *dbus.Conn
+	matches []string
+	signals chan *dbus.Signal
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// SignalMatch returns the match rule selecting the member signal of iface
+// sent by dest.
+func SignalMatch(dest, iface, member string) string {
+	return fmt.Sprintf("type='signal',sender='%s',interface='%s',member='%s'", dest, iface, member)
+}
+
+// Subscribe adds the given match rules to conn and starts receiving the
+// signals of the connection, to be handled with Dispatch. If a match rule
+// cannot be added, those added before are removed again.
+func Subscribe(conn *dbus.Conn, matches ...string) (*Subscription, error) {
+	for i, match := range matches {
+		err := conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, match).Store()
+		if err != nil {
+			for _, added := range matches[:i] {
+				conn.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, added)
+			}
+			return nil, err
+		}
+	}
+
+	sub := newSubscription(conn, matches)
+	conn.Signal(sub.signals)
+	return sub, nil
+}
+
+func newSubscription(conn *dbus.Conn, matches []string) *Subscription {
+	return &Subscription{
+		conn:    conn,
+		matches: matches,
+		signals: make(chan *dbus.Signal, 10),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Dispatch passes each signal received to deliver, until the subscription is
+// stopped. deliver must not block once done is closed, e.g. by selecting on
+// it when sending the signal on: from then on Dispatch only drains the
+// signals, so that they can be removed from the connection without blocking
+// its delivery. Dispatch is meant to run on its own goroutine.
+func (sub *Subscription) Dispatch(deliver func(sig *dbus.Signal, done <-chan struct{})) {
+	for {
+		select {
+		case sig, ok := <-sub.signals:
+			if !ok {
+				return
+			}
+			deliver(sig, sub.done)
+		case <-sub.stopped:
+			return
+		}
+	}
+}
+
+// Unsubscribe stops the subscription, making Dispatch return, and removes its
+// match rules from the connection.
+func (sub *Subscription) Unsubscribe() error {
+	sub.stop()
+
+	var err error
+	for _, match := range sub.matches {
+		if e := sub.conn.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, match).Store(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (sub *Subscription) stop() {
+	close(sub.done)
+	if sub.conn != nil {
+		sub.conn.RemoveSignal(sub.signals)
+	}
+	close(sub.stopped)
+}
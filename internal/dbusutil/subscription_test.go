@@ -0,0 +1,82 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dbusutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
+)
+
+func TestSignalMatch(t *testing.T) {
+	match := SignalMatch("org.freedesktop.login1", "org.freedesktop.login1.Manager", "SessionNew")
+	expected := "type='signal',sender='org.freedesktop.login1',interface='org.freedesktop.login1.Manager',member='SessionNew'"
+	if match != expected {
+		t.Errorf("expected %q, got %q", expected, match)
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	sub := newSubscription(nil, nil)
+	events := make(chan string)
+	go func() {
+		defer close(events)
+		sub.Dispatch(func(sig *dbus.Signal, done <-chan struct{}) {
+			if sig.Name == "ignored" {
+				return
+			}
+			select {
+			case events <- sig.Name:
+			case <-done:
+			}
+		})
+	}()
+
+	sub.signals <- &dbus.Signal{Name: "ignored"}
+	sub.signals <- &dbus.Signal{Name: "delivered"}
+
+	select {
+	case name := <-events:
+		if name != "delivered" {
+			t.Errorf("unexpected signal %q", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for signal")
+	}
+
+	// once done, signals are drained without blocking on events
+	close(sub.done)
+	for i := 0; i < 2*cap(sub.signals); i++ {
+		select {
+		case sub.signals <- &dbus.Signal{Name: "delivered"}:
+		case <-time.After(time.Second):
+			t.Fatal("signals not drained after unsubscribing")
+		}
+	}
+	close(sub.stopped)
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Dispatch did not return once stopped")
+		}
+	}
+}
@@ -31,6 +31,7 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"syscall"
@@ -60,16 +61,18 @@ func init() {
 	}
 }
 
-// Enabled returns true if the local systemd journal is available for logging
+// Enabled returns true if the local systemd journal is available for logging.
+// The journal socket is only probed once, when the package is initialized, so
+// it is cheap to call, e.g. to pick a logging backend at startup.
 func Enabled() bool {
 	return conn != nil
 }
 
 // Send a message to the local systemd journal. vars is a map of journald
 // fields to values.  Fields must be composed of uppercase letters, numbers,
-// and underscores, but must not start with an underscore. Within these
-// restrictions, any arbitrary field name may be used.  Some names have special
-// significance: see the journalctl documentation
+// and underscores, but must not start with an underscore or a number. Within
+// these restrictions, any arbitrary field name may be used.  Some names have
+// special significance: see the journalctl documentation
 // (http://www.freedesktop.org/software/systemd/man/systemd.journal-fields.html)
 // for more details.  vars may be nil.
 func Send(message string, priority Priority, vars map[string]string) error {
@@ -84,6 +87,36 @@ func Send(message string, priority Priority, vars map[string]string) error {
 		appendVariable(data, k, v)
 	}
 
+	return send(data)
+}
+
+// SendBinary works like Send, but takes field values as byte slices, which may
+// hold arbitrary data including newlines and NUL bytes. As with SendMap, an
+// invalid field name is reported as an error and nothing is sent. vars may be
+// nil.
+func SendBinary(message string, priority Priority, vars map[string][]byte) error {
+	if conn == nil {
+		return journalError("could not connect to journald socket")
+	}
+	for name := range vars {
+		if !validVarName(name) {
+			return invalidVarNameError(name)
+		}
+	}
+
+	data := new(bytes.Buffer)
+	appendVariable(data, "PRIORITY", strconv.Itoa(int(priority)))
+	appendVariable(data, "MESSAGE", message)
+	for k, v := range vars {
+		appendBinaryVariable(data, k, v)
+	}
+
+	return send(data)
+}
+
+// send writes a serialized message to the journal socket, passing it through
+// a temporary file when it is too large for a datagram.
+func send(data *bytes.Buffer) error {
 	_, err := io.Copy(conn, data)
 	if err != nil && isSocketSpaceError(err) {
 		file, err := tempFd()
@@ -109,6 +142,46 @@ func Send(message string, priority Priority, vars map[string]string) error {
 	return nil
 }
 
+// SendWithFallback works like Send when the local systemd journal is
+// available. Otherwise, e.g. when running in a container without systemd, it
+// writes the message to os.Stderr instead, prefixed with its priority as
+// understood by systemd for standard error, and followed by vars as
+// space-separated FIELD=value pairs sorted by name. Whether the journal is
+// available is only checked once, when the package is initialized.
+func SendWithFallback(message string, priority Priority, vars map[string]string) error {
+	if conn != nil {
+		return Send(message, priority, vars)
+	}
+
+	names := make([]string, 0, len(vars))
+	for k := range vars {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	line := new(bytes.Buffer)
+	fmt.Fprintf(line, "<%d>%s", priority, message)
+	for _, k := range names {
+		fmt.Fprintf(line, " %s=%s", k, vars[k])
+	}
+	line.WriteByte('\n')
+
+	_, err := line.WriteTo(os.Stderr)
+	return err
+}
+
+// SendMap sends a message to the local systemd journal like Send, with the
+// given fields, but first checks that all the field names are valid, returning
+// an error naming the first invalid one otherwise. fields may be nil.
+func SendMap(priority Priority, message string, fields map[string]string) error {
+	for name := range fields {
+		if !validVarName(name) {
+			return invalidVarNameError(name)
+		}
+	}
+	return Send(message, priority, fields)
+}
+
 // Print prints a message to the local systemd journal using Send().
 func Print(priority Priority, format string, a ...interface{}) error {
 	return Send(fmt.Sprintf(format, a...), priority, nil)
@@ -133,16 +206,36 @@ func appendVariable(w io.Writer, name, value string) {
 	}
 }
 
+// appendBinaryVariable writes a variable whose value may contain any byte,
+// always using the binary form: the variable name followed by a newline, the
+// size in 64bit little endian format, and the data followed by a newline.
+func appendBinaryVariable(w io.Writer, name string, value []byte) {
+	fmt.Fprintln(w, name)
+	binary.Write(w, binary.LittleEndian, uint64(len(value)))
+	w.Write(value)
+	fmt.Fprintln(w)
+}
+
 func validVarName(name string) bool {
 	/* The variable name must be in uppercase and consist only of characters,
 	 * numbers and underscores, and may not begin with an underscore. (from the docs)
+	 * Like journald, also refuse names beginning with a number.
 	 */
 
-	valid := name[0] != '_'
+	if name == "" || name[0] == '_' || ('0' <= name[0] && name[0] <= '9') {
+		return false
+	}
 	for _, c := range name {
-		valid = valid && ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || c == '_'
+		if !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') && c != '_' {
+			return false
+		}
 	}
-	return valid
+	return true
+}
+
+// invalidVarNameError reports a field name rejected by validVarName.
+func invalidVarNameError(name string) error {
+	return journalError(fmt.Sprintf("invalid field name %q: must consist of uppercase letters, numbers and underscores, and not start with an underscore or a number", name))
 }
 
 func isSocketSpaceError(err error) bool {
@@ -0,0 +1,238 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// listenJournal points the package at a unixgram socket in a temporary
+// directory standing in for journald, and returns it. The returned function
+// closes it and restores the previous connection.
+func listenJournal(t *testing.T) (*net.UnixConn, func()) {
+	dir, err := ioutil.TempDir("", "go-systemd-journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := &net.UnixAddr{Name: filepath.Join(dir, "socket"), Net: "unixgram"}
+	l, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	c, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		l.Close()
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	old := conn
+	conn = c
+	return l, func() {
+		conn = old
+		c.Close()
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// readMessage reads a serialized message sent to the journal socket l.
+func readMessage(t *testing.T, l *net.UnixConn) []byte {
+	buf := make([]byte, 64*1024)
+	l.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := l.Read(buf)
+	if err != nil {
+		t.Fatalf("error reading message: %v", err)
+	}
+	return buf[:n]
+}
+
+// binaryField returns the binary serialization of a field.
+func binaryField(name string, value []byte) []byte {
+	b := new(bytes.Buffer)
+	b.WriteString(name + "\n")
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.Write(value)
+	b.WriteString("\n")
+	return b.Bytes()
+}
+
+func TestValidVarName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"MESSAGE", true},
+		{"MY_FIELD", true},
+		{"FIELD_2", true},
+		{"A", true},
+
+		{"", false},
+		{"_PID", false},
+		{"1ST_FIELD", false},
+		{"lowercase", false},
+		{"Mixed_Case", false},
+		{"WITH-DASH", false},
+		{"WITH SPACE", false},
+		{"WITH=EQUALS", false},
+		{"ÜNICODE", false},
+	}
+
+	for _, tt := range tests {
+		if valid := validVarName(tt.name); valid != tt.valid {
+			t.Errorf("validVarName(%q): expected %t, got %t", tt.name, tt.valid, valid)
+		}
+	}
+}
+
+func TestSendMapInvalidName(t *testing.T) {
+	l, cleanup := listenJournal(t)
+	defer cleanup()
+
+	for _, name := range []string{"", "_TRUSTED", "lowercase", "2ND", "WITH-DASH"} {
+		if err := SendMap(PriInfo, "message", map[string]string{name: "value"}); err == nil {
+			t.Errorf("expected error for field name %q", name)
+		}
+	}
+
+	// Nothing may have been sent
+	l.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if n, err := l.Read(make([]byte, 1024)); err == nil {
+		t.Errorf("expected no message, got %d bytes", n)
+	}
+}
+
+func TestSendMap(t *testing.T) {
+	l, cleanup := listenJournal(t)
+	defer cleanup()
+
+	if err := SendMap(PriWarning, "hello", map[string]string{"MY_FIELD": "value"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := "PRIORITY=4\nMESSAGE=hello\nMY_FIELD=value\n"
+	if msg := readMessage(t, l); string(msg) != expected {
+		t.Errorf("expected %q, got %q", expected, msg)
+	}
+}
+
+func TestSendMultiline(t *testing.T) {
+	l, cleanup := listenJournal(t)
+	defer cleanup()
+
+	if err := Send("first\nsecond", PriInfo, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := append([]byte("PRIORITY=6\n"), binaryField("MESSAGE", []byte("first\nsecond"))...)
+	if msg := readMessage(t, l); !bytes.Equal(msg, expected) {
+		t.Errorf("expected %q, got %q", expected, msg)
+	}
+}
+
+func TestSendBinary(t *testing.T) {
+	tests := [][]byte{
+		[]byte("plain"),
+		[]byte("with\nnewline"),
+		[]byte("nul\x00and\xffinvalid utf-8"),
+		{},
+	}
+
+	l, cleanup := listenJournal(t)
+	defer cleanup()
+
+	for _, value := range tests {
+		if err := SendBinary("binary", PriInfo, map[string][]byte{"PAYLOAD": value}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := append([]byte("PRIORITY=6\nMESSAGE=binary\n"), binaryField("PAYLOAD", value)...)
+		if msg := readMessage(t, l); !bytes.Equal(msg, expected) {
+			t.Errorf("value %q: expected %q, got %q", value, expected, msg)
+		}
+	}
+}
+
+func TestSendBinaryInvalidName(t *testing.T) {
+	l, cleanup := listenJournal(t)
+	defer cleanup()
+
+	for _, name := range []string{"", "_TRUSTED", "lowercase", "2ND", "WITH-DASH"} {
+		if err := SendBinary("message", PriInfo, map[string][]byte{name: []byte("value")}); err == nil {
+			t.Errorf("expected error for field name %q", name)
+		}
+	}
+
+	// Nothing may have been sent
+	l.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if n, err := l.Read(make([]byte, 1024)); err == nil {
+		t.Errorf("expected no message, got %d bytes", n)
+	}
+}
+
+func TestSendNoJournal(t *testing.T) {
+	old := conn
+	conn = nil
+	defer func() { conn = old }()
+
+	if Enabled() {
+		t.Error("expected the journal to be disabled")
+	}
+	if err := Send("message", PriInfo, nil); err == nil {
+		t.Error("expected error from Send")
+	}
+	if err := SendBinary("message", PriInfo, nil); err == nil {
+		t.Error("expected error from SendBinary")
+	}
+}
+
+func TestSendWithFallback(t *testing.T) {
+	old := conn
+	conn = nil
+	defer func() { conn = old }()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	err = SendWithFallback("hello", PriWarning, map[string]string{"ZED": "last", "ALPHA": "first"})
+	os.Stderr = stderr
+	w.Close()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "<4>hello ALPHA=first ZED=last\n"
+	if string(out) != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+}
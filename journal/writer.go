@@ -0,0 +1,88 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxLine is the length beyond which lines are split into several messages,
+// like journald does by default for the standard output of services (see
+// LineMax= in journald.conf(5)), so that the buffer cannot grow unbounded.
+const maxLine = 48 * 1024
+
+// writer sends each line written to it as a journal message.
+type writer struct {
+	mu       sync.Mutex
+	priority Priority
+	vars     map[string]string
+	buf      []byte // partial line waiting for its newline
+}
+
+// NewWriter returns an io.WriteCloser sending each line written to it to the
+// local systemd journal as a separate message, at the given priority and with
+// the given fields attached. A trailing line without a newline is kept until it
+// is completed by a later write, or sent on Close. Lines longer than 48KiB are
+// split into several messages. It can be used wherever an io.Writer is
+// expected, e.g. as the output of a log.Logger. vars may be nil.
+func NewWriter(priority Priority, vars map[string]string) io.WriteCloser {
+	return &writer{priority: priority, vars: vars}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	all := w.buf
+	for {
+		var line string
+		if i := bytes.IndexByte(w.buf, '\n'); i >= 0 && i <= maxLine {
+			line = string(w.buf[:i])
+			w.buf = w.buf[i+1:]
+		} else if len(w.buf) > maxLine {
+			// Too long a line, send what fits
+			line = string(w.buf[:maxLine])
+			w.buf = w.buf[maxLine:]
+		} else {
+			break
+		}
+
+		if err := Send(line, w.priority, w.vars); err != nil {
+			return len(p), err
+		}
+	}
+
+	// Move the partial line to the front of the buffer, so that its space is
+	// reused rather than the buffer growing with every write
+	w.buf = all[:copy(all, w.buf)]
+	return len(p), nil
+}
+
+// Close sends the partial line left over from the last write, if any.
+func (w *writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	line := string(w.buf)
+	w.buf = w.buf[:0]
+	return Send(line, w.priority, w.vars)
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package journal
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// expectMessages checks that the given messages, and only those, were sent to
+// the journal socket l at PriInfo without extra fields.
+func expectMessages(t *testing.T, l *net.UnixConn, messages ...string) {
+	for _, m := range messages {
+		expected := "PRIORITY=6\nMESSAGE=" + m + "\n"
+		if msg := readMessage(t, l); string(msg) != expected {
+			t.Errorf("expected %q, got %q", expected, msg)
+		}
+	}
+
+	l.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if n, err := l.Read(make([]byte, 1024)); err == nil {
+		t.Errorf("expected no more messages, got %d bytes", n)
+	}
+}
+
+func TestWriterSplitWrites(t *testing.T) {
+	l, cleanup := listenJournal(t)
+	defer cleanup()
+
+	w := NewWriter(PriInfo, nil)
+	for _, s := range []string{"hel", "lo", "\nwor", "ld\n"} {
+		if n, err := w.Write([]byte(s)); err != nil || n != len(s) {
+			t.Fatalf("Write(%q): got %d, %v", s, n, err)
+		}
+	}
+
+	expectMessages(t, l, "hello", "world")
+}
+
+func TestWriterMultipleLines(t *testing.T) {
+	l, cleanup := listenJournal(t)
+	defer cleanup()
+
+	w := NewWriter(PriInfo, nil)
+	if _, err := w.Write([]byte("one\ntwo\n\nthree\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expectMessages(t, l, "one", "two", "", "three")
+}
+
+func TestWriterClose(t *testing.T) {
+	l, cleanup := listenJournal(t)
+	defer cleanup()
+
+	w := NewWriter(PriInfo, nil)
+	if _, err := w.Write([]byte("complete\npartial")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectMessages(t, l, "complete")
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectMessages(t, l, "partial")
+
+	// Nothing is left to send
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectMessages(t, l)
+}
+
+func TestWriterLongLine(t *testing.T) {
+	l, cleanup := listenJournal(t)
+	defer cleanup()
+
+	w := NewWriter(PriInfo, nil)
+	a := strings.Repeat("a", maxLine)
+	b := strings.Repeat("b", maxLine)
+
+	// A line without a newline is sent once it gets too long
+	if _, err := w.Write([]byte(a)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectMessages(t, l)
+	if _, err := w.Write([]byte(b + "c")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectMessages(t, l, a, b)
+
+	// A line with a newline too far away is split as well
+	if _, err := w.Write([]byte(b + "\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectMessages(t, l, "c"+b[1:], "b")
+}
@@ -16,22 +16,34 @@
 package login1
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/coreos/go-systemd/internal/dbusutil"
 	"github.com/godbus/dbus"
 )
 
 const (
-	dbusInterface = "org.freedesktop.login1.Manager"
-	dbusPath      = "/org/freedesktop/login1"
+	dbusDest             = "org.freedesktop.login1"
+	dbusInterface        = "org.freedesktop.login1.Manager"
+	dbusSessionInterface = "org.freedesktop.login1.Session"
+	dbusUserInterface    = "org.freedesktop.login1.User"
+	dbusSeatInterface    = "org.freedesktop.login1.Seat"
+	dbusPath             = "/org/freedesktop/login1"
 )
 
 // Conn is a connection to systemds dbus endpoint.
 type Conn struct {
 	conn   *dbus.Conn
 	object dbus.BusObject
+
+	sessionsLock sync.Mutex
+	sessions     *dbusutil.Subscription
 }
 
 // New() establishes a connection to the system bus and authenticates.
@@ -69,7 +81,7 @@ func (c *Conn) initConnection() error {
 		return err
 	}
 
-	c.object = c.conn.Object("org.freedesktop.login1", dbus.ObjectPath(dbusPath))
+	c.object = c.conn.Object(dbusDest, dbus.ObjectPath(dbusPath))
 
 	return nil
 }
@@ -79,8 +91,300 @@ func (c *Conn) Reboot(askForAuth bool) {
 	c.object.Call(dbusInterface+".Reboot", 0, askForAuth)
 }
 
-// Inhibit takes inhibition lock in logind.
+// Session is a session as returned by ListSessions.
+type Session struct {
+	ID   string
+	UID  uint32
+	User string
+	Seat string
+	Path dbus.ObjectPath
+}
+
+// ListSessions returns the sessions currently known to logind.
+func (c *Conn) ListSessions() ([]Session, error) {
+	sessions := make([]Session, 0)
+	err := c.object.Call(dbusInterface+".ListSessions", 0).Store(&sessions)
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// SessionProperties holds the properties of a session, as returned by
+// GetSession.
+type SessionProperties struct {
+	ID         string
+	Path       dbus.ObjectPath
+	UID        uint32
+	User       string
+	Seat       string
+	TTY        string
+	Display    string
+	Remote     bool
+	RemoteHost string
+	RemoteUser string
+	Service    string
+	Scope      string
+	Leader     uint32
+	Type       string
+	Class      string
+	Active     bool
+	State      string
+	IdleHint   bool
+	Timestamp  time.Time
+}
+
+// GetSession returns the properties of the session with the given id.
+func (c *Conn) GetSession(id string) (*SessionProperties, error) {
+	path, props, err := c.getObject("GetSession", dbusSessionInterface, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s := sessionProperties(props)
+	s.Path = path
+	return s, nil
+}
+
+// sessionProperties maps the dbus properties of a session to their typed
+// fields. Missing or mistyped properties are left to their zero value.
+func sessionProperties(props map[string]dbus.Variant) *SessionProperties {
+	return &SessionProperties{
+		ID:         propString(props, "Id"),
+		UID:        propStructUint32(props, "User"),
+		User:       propString(props, "Name"),
+		Seat:       propStructString(props, "Seat"),
+		TTY:        propString(props, "TTY"),
+		Display:    propString(props, "Display"),
+		Remote:     propBool(props, "Remote"),
+		RemoteHost: propString(props, "RemoteHost"),
+		RemoteUser: propString(props, "RemoteUser"),
+		Service:    propString(props, "Service"),
+		Scope:      propString(props, "Scope"),
+		Leader:     propUint32(props, "Leader"),
+		Type:       propString(props, "Type"),
+		Class:      propString(props, "Class"),
+		Active:     propBool(props, "Active"),
+		State:      propString(props, "State"),
+		IdleHint:   propBool(props, "IdleHint"),
+		Timestamp:  propTime(props, "Timestamp"),
+	}
+}
+
+// User is a user as returned by ListUsers.
+type User struct {
+	UID  uint32
+	Name string
+	Path dbus.ObjectPath
+}
+
+// ListUsers returns the users currently logged in.
+func (c *Conn) ListUsers() ([]User, error) {
+	users := make([]User, 0)
+	err := c.object.Call(dbusInterface+".ListUsers", 0).Store(&users)
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// UserProperties holds the properties of a user, as returned by GetUser.
+type UserProperties struct {
+	UID         uint32
+	GID         uint32
+	Name        string
+	Path        dbus.ObjectPath
+	State       string
+	Display     string
+	Sessions    []string
+	RuntimePath string
+	Service     string
+	Slice       string
+	IdleHint    bool
+	Linger      bool
+	Timestamp   time.Time
+}
+
+// GetUser returns the properties of the user with the given uid.
+func (c *Conn) GetUser(uid uint32) (*UserProperties, error) {
+	path, props, err := c.getObject("GetUser", dbusUserInterface, uid)
+	if err != nil {
+		return nil, err
+	}
+
+	u := userProperties(props)
+	u.Path = path
+	return u, nil
+}
+
+func userProperties(props map[string]dbus.Variant) *UserProperties {
+	return &UserProperties{
+		UID:         propUint32(props, "UID"),
+		GID:         propUint32(props, "GID"),
+		Name:        propString(props, "Name"),
+		State:       propString(props, "State"),
+		Display:     propStructString(props, "Display"),
+		Sessions:    propStructStrings(props, "Sessions"),
+		RuntimePath: propString(props, "RuntimePath"),
+		Service:     propString(props, "Service"),
+		Slice:       propString(props, "Slice"),
+		IdleHint:    propBool(props, "IdleHint"),
+		Linger:      propBool(props, "Linger"),
+		Timestamp:   propTime(props, "Timestamp"),
+	}
+}
+
+// Seat is a seat as returned by ListSeats.
+type Seat struct {
+	ID   string
+	Path dbus.ObjectPath
+}
+
+// ListSeats returns the seats known to logind.
+func (c *Conn) ListSeats() ([]Seat, error) {
+	seats := make([]Seat, 0)
+	err := c.object.Call(dbusInterface+".ListSeats", 0).Store(&seats)
+	if err != nil {
+		return nil, err
+	}
+	return seats, nil
+}
+
+// SeatProperties holds the properties of a seat, as returned by GetSeat.
+type SeatProperties struct {
+	ID              string
+	Path            dbus.ObjectPath
+	ActiveSession   string
+	Sessions        []string
+	CanMultiSession bool
+	CanTTY          bool
+	CanGraphical    bool
+	IdleHint        bool
+}
+
+// GetSeat returns the properties of the seat with the given id.
+func (c *Conn) GetSeat(id string) (*SeatProperties, error) {
+	path, props, err := c.getObject("GetSeat", dbusSeatInterface, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s := seatProperties(props)
+	s.Path = path
+	return s, nil
+}
+
+func seatProperties(props map[string]dbus.Variant) *SeatProperties {
+	return &SeatProperties{
+		ID:              propString(props, "Id"),
+		ActiveSession:   propStructString(props, "ActiveSession"),
+		Sessions:        propStructStrings(props, "Sessions"),
+		CanMultiSession: propBool(props, "CanMultiSession"),
+		CanTTY:          propBool(props, "CanTTY"),
+		CanGraphical:    propBool(props, "CanGraphical"),
+		IdleHint:        propBool(props, "IdleHint"),
+	}
+}
+
+// getObject looks up the path of an object with the given manager method,
+// and returns it along with all of its properties on iface.
+func (c *Conn) getObject(method, iface string, args ...interface{}) (dbus.ObjectPath, map[string]dbus.Variant, error) {
+	var path dbus.ObjectPath
+	err := c.object.Call(dbusInterface+"."+method, 0, args...).Store(&path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var props map[string]dbus.Variant
+	obj := c.conn.Object(dbusDest, path)
+	err = obj.Call("org.freedesktop.DBus.Properties.GetAll", 0, iface).Store(&props)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return path, props, nil
+}
+
+// The prop helpers below return the zero value for missing or mistyped
+// properties.
+
+func propString(props map[string]dbus.Variant, name string) string {
+	v, _ := props[name].Value().(string)
+	return v
+}
+
+func propBool(props map[string]dbus.Variant, name string) bool {
+	v, _ := props[name].Value().(bool)
+	return v
+}
+
+func propUint32(props map[string]dbus.Variant, name string) uint32 {
+	v, _ := props[name].Value().(uint32)
+	return v
+}
+
+func propTime(props map[string]dbus.Variant, name string) time.Time {
+	usec, ok := props[name].Value().(uint64)
+	if !ok || usec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(usec)*int64(time.Microsecond))
+}
+
+// propStruct returns the fields of a struct property, such as (so).
+func propStruct(props map[string]dbus.Variant, name string) []interface{} {
+	v, _ := props[name].Value().([]interface{})
+	return v
+}
+
+// propStructString returns the string identifying a (so) property, such as
+// a session or seat id.
+func propStructString(props map[string]dbus.Variant, name string) string {
+	if v := propStruct(props, name); len(v) > 0 {
+		s, _ := v[0].(string)
+		return s
+	}
+	return ""
+}
+
+// propStructUint32 returns the uid identifying a (uo) property.
+func propStructUint32(props map[string]dbus.Variant, name string) uint32 {
+	if v := propStruct(props, name); len(v) > 0 {
+		u, _ := v[0].(uint32)
+		return u
+	}
+	return 0
+}
+
+// propStructStrings returns the ids of an a(so) property.
+func propStructStrings(props map[string]dbus.Variant, name string) []string {
+	ids := make([]string, 0)
+	structs, _ := props[name].Value().([][]interface{})
+	for _, v := range structs {
+		if len(v) > 0 {
+			if s, ok := v[0].(string); ok {
+				ids = append(ids, s)
+			}
+		}
+	}
+	return ids
+}
+
+// Inhibit takes inhibition lock in logind. what is a colon separated list
+// of the operations to inhibit, such as "shutdown:sleep", and mode is
+// either "block" or "delay". The lock is held until the returned file is
+// closed, or the process exits.
 func (c *Conn) Inhibit(what, who, why, mode string) (*os.File, error) {
+	if mode != "block" && mode != "delay" {
+		return nil, fmt.Errorf("invalid inhibit mode %q", mode)
+	}
+
+	// The lock is returned as a file descriptor, which can only be
+	// received once passing fds has been negotiated with the bus.
+	if !c.conn.SupportsUnixFDs() {
+		return nil, errors.New("dbus connection does not support passing file descriptors")
+	}
+
 	var fd dbus.UnixFD
 
 	err := c.object.Call(dbusInterface+".Inhibit", 0, what, who, why, mode).Store(&fd)
@@ -88,7 +392,10 @@ func (c *Conn) Inhibit(what, who, why, mode string) (*os.File, error) {
 		return nil, err
 	}
 
-	return os.NewFile(uintptr(fd), "inhibit"), nil
+	// keep the lock from leaking into child processes
+	syscall.CloseOnExec(int(fd))
+
+	return os.NewFile(uintptr(fd), "inhibit:"+what), nil
 }
 
 // Subscribe to signals on the logind dbus
@@ -102,6 +409,97 @@ func (c *Conn) Subscribe(members ...string) chan *dbus.Signal {
 	return ch
 }
 
+// SessionEvent reports a session being created or removed.
+type SessionEvent struct {
+	ID      string
+	Path    dbus.ObjectPath
+	Removed bool
+}
+
+var sessionSignals = []string{"SessionNew", "SessionRemoved"}
+
+// SubscribeSessions delivers an event on the returned channel whenever a
+// session is created or removed, until UnsubscribeSessions is called, which
+// closes the channel. Only one subscription may be active at a time.
+func (c *Conn) SubscribeSessions() (<-chan SessionEvent, error) {
+	c.sessionsLock.Lock()
+	defer c.sessionsLock.Unlock()
+
+	if c.sessions != nil {
+		return nil, errors.New("already subscribed to sessions")
+	}
+
+	var matches []string
+	for _, member := range sessionSignals {
+		matches = append(matches, dbusutil.SignalMatch(dbusDest, dbusInterface, member))
+	}
+	sub, err := dbusutil.Subscribe(c.conn, matches...)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan SessionEvent, 10)
+	go func() {
+		defer close(events)
+		sub.Dispatch(func(sig *dbus.Signal, done <-chan struct{}) {
+			ev, ok := sessionEvent(sig)
+			if !ok {
+				return
+			}
+			select {
+			case events <- ev:
+			case <-done:
+			}
+		})
+	}()
+
+	c.sessions = sub
+	return events, nil
+}
+
+func sessionEvent(sig *dbus.Signal) (SessionEvent, bool) {
+	var ev SessionEvent
+
+	switch sig.Name {
+	case dbusInterface + ".SessionNew":
+	case dbusInterface + ".SessionRemoved":
+		ev.Removed = true
+	default:
+		return ev, false
+	}
+
+	if len(sig.Body) < 2 {
+		return ev, false
+	}
+	id, ok := sig.Body[0].(string)
+	if !ok {
+		return ev, false
+	}
+	path, ok := sig.Body[1].(dbus.ObjectPath)
+	if !ok {
+		return ev, false
+	}
+
+	ev.ID = id
+	ev.Path = path
+	return ev, true
+}
+
+// UnsubscribeSessions stops the subscription started by SubscribeSessions
+// and removes its dbus matches.
+func (c *Conn) UnsubscribeSessions() error {
+	c.sessionsLock.Lock()
+	defer c.sessionsLock.Unlock()
+
+	sub := c.sessions
+	if sub == nil {
+		return errors.New("not subscribed to sessions")
+	}
+	c.sessions = nil
+
+	return sub.Unsubscribe()
+}
+
 // PowerOff asks logind for a power off optionally asking for auth.
 func (c *Conn) PowerOff(askForAuth bool) {
 	c.object.Call(dbusInterface+".PowerOff", 0, askForAuth)
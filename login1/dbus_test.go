@@ -15,7 +15,11 @@
 package login1
 
 import (
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/godbus/dbus"
 )
 
 // TestNew ensures that New() works without errors.
@@ -26,3 +30,147 @@ func TestNew(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestSessionProperties(t *testing.T) {
+	props := map[string]dbus.Variant{
+		"Id":         dbus.MakeVariant("c2"),
+		"Name":       dbus.MakeVariant("core"),
+		"User":       dbus.MakeVariant([]interface{}{uint32(500), dbus.ObjectPath("/org/freedesktop/login1/user/_500")}),
+		"Seat":       dbus.MakeVariant([]interface{}{"seat0", dbus.ObjectPath("/org/freedesktop/login1/seat/seat0")}),
+		"TTY":        dbus.MakeVariant("tty1"),
+		"Remote":     dbus.MakeVariant(true),
+		"RemoteHost": dbus.MakeVariant("10.0.0.1"),
+		"Service":    dbus.MakeVariant("sshd"),
+		"Leader":     dbus.MakeVariant(uint32(1234)),
+		"Type":       dbus.MakeVariant("tty"),
+		"Class":      dbus.MakeVariant("user"),
+		"Active":     dbus.MakeVariant(true),
+		"State":      dbus.MakeVariant("active"),
+		"Timestamp":  dbus.MakeVariant(uint64(1420070400000000)),
+	}
+
+	s := sessionProperties(props)
+	expect := &SessionProperties{
+		ID:         "c2",
+		UID:        500,
+		User:       "core",
+		Seat:       "seat0",
+		TTY:        "tty1",
+		Remote:     true,
+		RemoteHost: "10.0.0.1",
+		Service:    "sshd",
+		Leader:     1234,
+		Type:       "tty",
+		Class:      "user",
+		Active:     true,
+		State:      "active",
+		Timestamp:  time.Unix(1420070400, 0),
+	}
+
+	if !reflect.DeepEqual(s, expect) {
+		t.Errorf("unexpected properties: %+v", s)
+	}
+
+	if s := sessionProperties(map[string]dbus.Variant{}); !reflect.DeepEqual(s, &SessionProperties{}) {
+		t.Errorf("expected zero properties, got %+v", s)
+	}
+}
+
+func TestSessionEvent(t *testing.T) {
+	tests := []struct {
+		sig *dbus.Signal
+		ev  SessionEvent
+		ok  bool
+	}{
+		{
+			&dbus.Signal{Name: dbusInterface + ".SessionNew", Body: []interface{}{"c1", dbus.ObjectPath("/org/freedesktop/login1/session/c1")}},
+			SessionEvent{ID: "c1", Path: "/org/freedesktop/login1/session/c1"},
+			true,
+		},
+		{
+			&dbus.Signal{Name: dbusInterface + ".SessionRemoved", Body: []interface{}{"c1", dbus.ObjectPath("/org/freedesktop/login1/session/c1")}},
+			SessionEvent{ID: "c1", Path: "/org/freedesktop/login1/session/c1", Removed: true},
+			true,
+		},
+		{
+			&dbus.Signal{Name: dbusInterface + ".SeatNew", Body: []interface{}{"seat0", dbus.ObjectPath("/org/freedesktop/login1/seat/seat0")}},
+			SessionEvent{},
+			false,
+		},
+		{
+			&dbus.Signal{Name: dbusInterface + ".SessionNew", Body: []interface{}{"c1"}},
+			SessionEvent{},
+			false,
+		},
+	}
+
+	for i, tt := range tests {
+		ev, ok := sessionEvent(tt.sig)
+		if ok != tt.ok {
+			t.Errorf("case %d: expected ok=%v, got %v", i, tt.ok, ok)
+			continue
+		}
+		if ok && ev != tt.ev {
+			t.Errorf("case %d: expected %+v, got %+v", i, tt.ev, ev)
+		}
+	}
+}
+
+func TestInhibitInvalidMode(t *testing.T) {
+	c := &Conn{}
+	if _, err := c.Inhibit("sleep", "test", "testing", "wait"); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+}
+
+func TestUserProperties(t *testing.T) {
+	props := map[string]dbus.Variant{
+		"UID":     dbus.MakeVariant(uint32(500)),
+		"GID":     dbus.MakeVariant(uint32(500)),
+		"Name":    dbus.MakeVariant("core"),
+		"State":   dbus.MakeVariant("active"),
+		"Display": dbus.MakeVariant([]interface{}{"c2", dbus.ObjectPath("/org/freedesktop/login1/session/c2")}),
+		"Sessions": dbus.MakeVariant([][]interface{}{
+			{"c1", dbus.ObjectPath("/org/freedesktop/login1/session/c1")},
+			{"c2", dbus.ObjectPath("/org/freedesktop/login1/session/c2")},
+		}),
+		"Linger": dbus.MakeVariant(true),
+	}
+
+	u := userProperties(props)
+	expect := &UserProperties{
+		UID:      500,
+		GID:      500,
+		Name:     "core",
+		State:    "active",
+		Display:  "c2",
+		Sessions: []string{"c1", "c2"},
+		Linger:   true,
+	}
+
+	if !reflect.DeepEqual(u, expect) {
+		t.Errorf("unexpected properties: %+v", u)
+	}
+}
+
+func TestSeatProperties(t *testing.T) {
+	props := map[string]dbus.Variant{
+		"Id":            dbus.MakeVariant("seat0"),
+		"ActiveSession": dbus.MakeVariant([]interface{}{"c2", dbus.ObjectPath("/org/freedesktop/login1/session/c2")}),
+		"CanTTY":        dbus.MakeVariant(true),
+		"CanGraphical":  dbus.MakeVariant(true),
+	}
+
+	s := seatProperties(props)
+	expect := &SeatProperties{
+		ID:            "seat0",
+		ActiveSession: "c2",
+		Sessions:      []string{},
+		CanTTY:        true,
+		CanGraphical:  true,
+	}
+
+	if !reflect.DeepEqual(s, expect) {
+		t.Errorf("unexpected properties: %+v", s)
+	}
+}
@@ -18,8 +18,12 @@ limitations under the License.
 package machine1
 
 import (
+	"errors"
+	"fmt"
+	"net"
 	"os"
 	"strconv"
+	"syscall"
 
 	"github.com/godbus/dbus"
 )
@@ -77,5 +81,100 @@ func (c *Conn) initConnection() error {
 
 // RegisterMachine registers the container with the systemd-machined
 func (c *Conn) RegisterMachine(name string, id []byte, service string, class string, pid int, root_directory string) error {
+	if err := validMachineID(id); err != nil {
+		return err
+	}
 	return c.object.Call(dbusInterface+".RegisterMachine", 0, name, id, service, class, uint32(pid), root_directory).Err
 }
+
+// RegisterMachineWithNetwork registers the container with the
+// systemd-machined like RegisterMachine, along with the indices of the
+// network interfaces it owns.
+func (c *Conn) RegisterMachineWithNetwork(name string, id []byte, service string, class string, pid int, root_directory string, ifindices []int) error {
+	if err := validMachineID(id); err != nil {
+		return err
+	}
+	netif := make([]int32, len(ifindices))
+	for i, idx := range ifindices {
+		netif[i] = int32(idx)
+	}
+	return c.object.Call(dbusInterface+".RegisterMachineWithNetwork", 0, name, id, service, class, uint32(pid), root_directory, netif).Err
+}
+
+// TerminateMachine terminates all processes of the machine and unregisters
+// it from systemd-machined.
+func (c *Conn) TerminateMachine(name string) error {
+	return c.object.Call(dbusInterface+".TerminateMachine", 0, name).Err
+}
+
+// OpenMachinePTY allocates a pseudo TTY in the machine and returns the
+// master side of it along with the path of the slave side inside the
+// machine. The caller owns the returned file and must close it.
+func (c *Conn) OpenMachinePTY(name string) (*os.File, string, error) {
+	// The master is returned as a file descriptor, which can only be
+	// received once passing fds has been negotiated with the bus.
+	if !c.conn.SupportsUnixFDs() {
+		return nil, "", errors.New("dbus connection does not support passing file descriptors")
+	}
+
+	var fd dbus.UnixFD
+	var path string
+
+	err := c.object.Call(dbusInterface+".OpenMachinePTY", 0, name).Store(&fd, &path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// keep the pty from leaking into child processes
+	syscall.CloseOnExec(int(fd))
+
+	return os.NewFile(uintptr(fd), path), path, nil
+}
+
+// GetMachineAddresses returns the IP addresses of the machine's network
+// interfaces.
+func (c *Conn) GetMachineAddresses(name string) ([]net.IP, error) {
+	result := make([][]interface{}, 0)
+	err := c.object.Call(dbusInterface+".GetMachineAddresses", 0, name).Store(&result)
+	if err != nil {
+		return nil, err
+	}
+	return parseAddresses(result)
+}
+
+// parseAddresses decodes the (iay) family and address pairs returned by
+// GetMachineAddresses.
+func parseAddresses(result [][]interface{}) ([]net.IP, error) {
+	addrs := make([]net.IP, 0, len(result))
+	for _, r := range result {
+		if len(r) != 2 {
+			return nil, fmt.Errorf("invalid address %v", r)
+		}
+		family, ok := r[0].(int32)
+		if !ok {
+			return nil, fmt.Errorf("invalid address family %v", r[0])
+		}
+		addr, ok := r[1].([]byte)
+		if !ok {
+			return nil, fmt.Errorf("invalid address %v", r[1])
+		}
+
+		switch {
+		case family == syscall.AF_INET && len(addr) == net.IPv4len:
+		case family == syscall.AF_INET6 && len(addr) == net.IPv6len:
+		default:
+			return nil, fmt.Errorf("invalid address of family %d and length %d", family, len(addr))
+		}
+		addrs = append(addrs, net.IP(addr))
+	}
+	return addrs, nil
+}
+
+// validMachineID checks that id is a 128 bit machine id, or empty to let
+// systemd-machined pick one.
+func validMachineID(id []byte) error {
+	if len(id) != 0 && len(id) != 16 {
+		return fmt.Errorf("invalid machine id length %d, must be 16 bytes", len(id))
+	}
+	return nil
+}
@@ -17,6 +17,8 @@ limitations under the License.
 package machine1
 
 import (
+	"net"
+	"syscall"
 	"testing"
 )
 
@@ -28,3 +30,57 @@ func TestNew(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestValidMachineID(t *testing.T) {
+	tests := []struct {
+		id    []byte
+		valid bool
+	}{
+		{nil, true},
+		{make([]byte, 16), true},
+		{make([]byte, 15), false},
+		{make([]byte, 32), false},
+	}
+
+	for i, tt := range tests {
+		err := validMachineID(tt.id)
+		if tt.valid && err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
+
+func TestParseAddresses(t *testing.T) {
+	addrs, err := parseAddresses([][]interface{}{
+		{int32(syscall.AF_INET), []byte{10, 0, 0, 2}},
+		{int32(syscall.AF_INET6), []byte(net.ParseIP("fe80::1"))},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expect := []net.IP{net.ParseIP("10.0.0.2"), net.ParseIP("fe80::1")}
+	if len(addrs) != len(expect) {
+		t.Fatalf("expected %v, got %v", expect, addrs)
+	}
+	for i := range addrs {
+		if !addrs[i].Equal(expect[i]) {
+			t.Errorf("expected %v, got %v", expect[i], addrs[i])
+		}
+	}
+
+	invalid := [][][]interface{}{
+		{{int32(syscall.AF_INET), []byte{10, 0, 0}}},
+		{{int32(syscall.AF_INET6), []byte{10, 0, 0, 2}}},
+		{{int32(syscall.AF_UNIX), []byte{10, 0, 0, 2}}},
+		{{"inet", []byte{10, 0, 0, 2}}},
+	}
+	for i, tt := range invalid {
+		if _, err := parseAddresses(tt); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
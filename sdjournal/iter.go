@@ -0,0 +1,73 @@
+// Copyright 2015 RedHat, Inc.
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.23
+// +build go1.23
+
+package sdjournal
+
+import (
+	"io"
+	"iter"
+
+	"golang.org/x/net/context"
+)
+
+// All returns an iterator over the remaining entries of the JournalReader, as
+// returned by ReadEntry, for use with range:
+//
+//	for entry, err := range r.All(ctx) {
+//		...
+//	}
+//
+// Iteration stops at the tail of the journal, unless Follow is set, in which
+// case it waits for new entries until ctx is done or the reader is closed,
+// which also ends iteration. If reading fails, or ctx is
+// done, a final nil entry is yielded along with the error, ErrExpired in the
+// latter case. When ReuseEntries is set, each entry is released once the loop
+// body is done with it.
+func (r *JournalReader) All(ctx context.Context) iter.Seq2[JournalEntry, error] {
+	return func(yield func(JournalEntry, error) bool) {
+		for {
+			select {
+			case <-ctx.Done():
+				yield(nil, ErrExpired)
+				return
+			default:
+			}
+
+			var entry JournalEntry
+			var err error
+			if r.config.Follow {
+				entry, err = r.ReadEntryContext(ctx)
+			} else {
+				entry, err = r.nextEntry()
+			}
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			more := yield(entry, nil)
+			r.ReleaseEntry(entry)
+			if !more {
+				return
+			}
+		}
+	}
+}
@@ -26,20 +26,140 @@ package sdjournal
 
 /*
 #cgo pkg-config: libsystemd
+#cgo LDFLAGS: -ldl
+#define _GNU_SOURCE
 #include <systemd/sd-journal.h>
 #include <systemd/sd-id128.h>
 #include <stdlib.h>
 #include <syslog.h>
+#include <errno.h>
+#include <dlfcn.h>
+#include <poll.h>
+#include <time.h>
+
+// sd_journal_open_namespace only exists in systemd >= 245, so resolve it at
+// runtime rather than failing to link against older versions.
+int
+my_sd_journal_open_namespace(sd_journal **ret, const char *name_space, int flags)
+{
+  int (*sd_journal_open_namespace)(sd_journal **, const char *, int);
+
+  sd_journal_open_namespace = (int (*)(sd_journal **, const char *, int))dlsym(RTLD_DEFAULT, "sd_journal_open_namespace");
+  if (sd_journal_open_namespace == NULL)
+    return -ENOSYS;
+
+  return sd_journal_open_namespace(ret, name_space, flags);
+}
+
+// sd_journal_get_seqnum only exists in systemd >= 254.
+int
+my_sd_journal_get_seqnum(sd_journal *j, uint64_t *ret_seqnum, sd_id128_t *ret_seqnum_id)
+{
+  int (*sd_journal_get_seqnum)(sd_journal *, uint64_t *, sd_id128_t *);
+
+  sd_journal_get_seqnum = (int (*)(sd_journal *, uint64_t *, sd_id128_t *))dlsym(RTLD_DEFAULT, "sd_journal_get_seqnum");
+  if (sd_journal_get_seqnum == NULL)
+    return -ENOSYS;
+
+  return sd_journal_get_seqnum(j, ret_seqnum, ret_seqnum_id);
+}
+
+// sd_journal_enumerate_available_data only exists in systemd >= 246. Unlike
+// sd_journal_enumerate_data, it skips fields which cannot be read, e.g. as
+// they use an unsupported compression, rather than failing on them. It is
+// called once per field, so the lookup is only done once; concurrent lookups
+// store the same value.
+int
+my_sd_journal_enumerate_available_data(sd_journal *j, const void **data, size_t *l)
+{
+  static int (*sd_journal_enumerate_available_data)(sd_journal *, const void **, size_t *);
+  static int resolved;
+
+  if (!resolved) {
+    sd_journal_enumerate_available_data = (int (*)(sd_journal *, const void **, size_t *))dlsym(RTLD_DEFAULT, "sd_journal_enumerate_available_data");
+    resolved = 1;
+  }
+  if (sd_journal_enumerate_available_data == NULL)
+    return sd_journal_enumerate_data(j, data, l);
+
+  return sd_journal_enumerate_available_data(j, data, l);
+}
+
+// Gets what sd_journal_wait would poll for: the journal fd, the events to poll
+// it for, and the poll timeout in milliseconds, -1 meaning none.
+int
+my_sd_journal_wait_params(sd_journal *j, int *fd, int *events, int *timeout_ms)
+{
+  struct timespec ts;
+  uint64_t timeout_usec, now_usec;
+  int r;
+
+  *fd = sd_journal_get_fd(j);
+  if (*fd < 0)
+    return *fd;
+
+  *events = sd_journal_get_events(j);
+  if (*events < 0)
+    return *events;
+
+  r = sd_journal_get_timeout(j, &timeout_usec);
+  if (r < 0)
+    return r;
+
+  *timeout_ms = -1;
+  if (timeout_usec != (uint64_t) -1) {
+    clock_gettime(CLOCK_MONOTONIC, &ts);
+    now_usec = (uint64_t) ts.tv_sec * 1000000 + ts.tv_nsec / 1000;
+    *timeout_ms = timeout_usec > now_usec ? (timeout_usec - now_usec + 999) / 1000 : 0;
+  }
+
+  return 0;
+}
+
+// Polls fd for events like sd_journal_wait, but returns -ECANCELED as soon as
+// cancel_fd becomes readable. It does not touch the journal itself, so that
+// it can run without holding the journal lock.
+int
+my_poll_cancellable(int fd, int events, int cancel_fd, int timeout_ms)
+{
+  struct pollfd fds[2];
+  int r;
+
+  fds[0].fd = fd;
+  fds[0].events = events;
+  fds[1].fd = cancel_fd;
+  fds[1].events = POLLIN;
+
+  do {
+    r = poll(fds, 2, timeout_ms);
+  } while (r < 0 && errno == EINTR);
+
+  if (r < 0)
+    return -errno;
+
+  if (fds[1].revents != 0)
+    return -ECANCELED;
+
+  return 0;
+}
 */
 import "C"
 import (
+	"errors"
 	"fmt"
+	"math"
+	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 	"unicode/utf8"
 	"unsafe"
+
+	"golang.org/x/net/context"
 )
 
 // Journal entry field strings which correspond to:
@@ -52,6 +172,9 @@ const (
 	SD_JOURNAL_FIELD_GID          = "_GID"
 	SD_JOURNAL_FIELD_HOSTNAME     = "_HOSTNAME"
 	SD_JOURNAL_FIELD_MACHINE_ID   = "_MACHINE_ID"
+	SD_JOURNAL_FIELD_PRIORITY     = "PRIORITY"
+	SD_JOURNAL_FIELD_TRANSPORT    = "_TRANSPORT"
+	SD_JOURNAL_FIELD_BOOT_ID      = "_BOOT_ID"
 )
 
 // Journal event constants
@@ -61,6 +184,14 @@ const (
 	SD_JOURNAL_INVALIDATE = int(C.SD_JOURNAL_INVALIDATE)
 )
 
+// Journal open flags, which may be OR'ed together
+const (
+	SD_JOURNAL_LOCAL_ONLY   = int(C.SD_JOURNAL_LOCAL_ONLY)
+	SD_JOURNAL_RUNTIME_ONLY = int(C.SD_JOURNAL_RUNTIME_ONLY)
+	SD_JOURNAL_SYSTEM       = int(C.SD_JOURNAL_SYSTEM)
+	SD_JOURNAL_CURRENT_USER = int(C.SD_JOURNAL_CURRENT_USER)
+)
+
 const (
 	// IndefiniteWait is a sentinel value that can be passed to
 	// sdjournal.Wait() to signal an indefinite wait for new journal
@@ -69,15 +200,106 @@ const (
 	IndefiniteWait time.Duration = 1<<63 - 1
 )
 
+// ErrJournalClosed is returned by WaitContext when the journal is closed
+// while, or before, waiting.
+var ErrJournalClosed = errors.New("journal closed")
+
+// ErrNoCatalogEntry is returned by GetCatalog when the message catalog has no
+// entry for the current journal entry.
+var ErrNoCatalogEntry = errors.New("no catalog entry for current journal entry")
+
+// ErrSeqnumNotSupported is returned by GetSeqnum when libsystemd is older
+// than 254.
+var ErrSeqnumNotSupported = errors.New("sequence numbers not supported by libsystemd")
+
 // Journal is a Go wrapper of an sd_journal structure.
+//
+// A Journal is safe for concurrent use: every call into sd-journal is
+// serialized by an internal mutex, and calls made after Close fail rather than
+// touching freed memory. Note that the read pointer is shared, so goroutines
+// moving it concurrently will see each other's effects; use a Journal per
+// goroutine to iterate independently.
 type Journal struct {
 	cjournal *C.sd_journal
 	mu       sync.Mutex
+	closed   bool
+	done     chan struct{} // closed by Close, to wake up waiters
+}
+
+// closing returns a channel closed once the journal is closed.
+func (j *Journal) closing() <-chan struct{} {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.done == nil {
+		j.done = make(chan struct{})
+		if j.closed {
+			close(j.done)
+		}
+	}
+	return j.done
 }
 
 // JournalEntry is an alias for map[string]interface{}
 type JournalEntry map[string]interface{}
 
+// Field returns the value of the given field, or "" if the entry lacks it.
+// If the field is repeated, its first value is returned.
+func (e JournalEntry) Field(name string) string {
+	switch v := e[name].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case []string:
+		if len(v) > 0 {
+			return v[0]
+		}
+	case [][]byte:
+		if len(v) > 0 {
+			return string(v[0])
+		}
+	}
+	return ""
+}
+
+// Priority returns the PRIORITY of the entry, from 0 (emerg) to 7 (debug).
+// Entries without a valid priority are reported as 6 (info), which is what
+// journald assumes for them.
+func (e JournalEntry) Priority() int {
+	p, err := strconv.Atoi(strings.TrimSpace(e.Field(SD_JOURNAL_FIELD_PRIORITY)))
+	if err != nil || p < 0 || p > 7 {
+		return 6
+	}
+	return p
+}
+
+// Unit returns the _SYSTEMD_UNIT of the entry, or "" if it has none.
+func (e JournalEntry) Unit() string {
+	return e.Field(SD_JOURNAL_FIELD_SYSTEMD_UNIT)
+}
+
+// Message returns the MESSAGE of the entry, or "" if it has none.
+func (e JournalEntry) Message() string {
+	return e.Field(SD_JOURNAL_FIELD_MESSAGE)
+}
+
+// Time returns the wallclock time the entry was logged at, as recorded in
+// __REALTIME_TIMESTAMP by GetDataAll, or the zero time if it is unknown.
+func (e JournalEntry) Time() time.Time {
+	var usec uint64
+	switch v := e["__REALTIME_TIMESTAMP"].(type) {
+	case uint64:
+		usec = v
+	case string:
+		usec, _ = strconv.ParseUint(v, 10, 64)
+	}
+	if usec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(usec)*int64(time.Microsecond))
+}
+
 // Match is a convenience wrapper to describe filters supplied to AddMatch.
 type Match struct {
 	Field string
@@ -89,10 +311,165 @@ func (m *Match) String() string {
 	return m.Field + "=" + m.Value
 }
 
+// ParseMatch parses a match of the form FIELD=value, as returned by
+// Match.String, e.g. so that matches can be given as plain strings in
+// configuration files. The value may be empty, but the field name must be a
+// valid journal field name.
+func ParseMatch(s string) (Match, error) {
+	i := strings.IndexByte(s, '=')
+	if i < 0 {
+		return Match{}, fmt.Errorf("invalid match %q: must be of the form FIELD=value", s)
+	}
+	if !validFieldName(s[:i]) {
+		return Match{}, fmt.Errorf("invalid match %q: malformed field name", s)
+	}
+	return Match{Field: s[:i], Value: s[i+1:]}, nil
+}
+
+// MatchBootID returns a match selecting entries logged during the boot with
+// the given 32 character hexadecimal ID.
+func MatchBootID(bootID string) (Match, error) {
+	if !validID128(bootID) {
+		return Match{}, fmt.Errorf("invalid boot ID %q: must be 32 hexadecimal characters", bootID)
+	}
+	return Match{Field: SD_JOURNAL_FIELD_BOOT_ID, Value: bootID}, nil
+}
+
+// MatchTransport returns a match selecting entries received through the given
+// transport, one of "audit", "driver", "syslog", "journal", "stdout" or
+// "kernel".
+func MatchTransport(transport string) (Match, error) {
+	switch transport {
+	case "audit", "driver", "syslog", "journal", "stdout", "kernel":
+		return Match{Field: SD_JOURNAL_FIELD_TRANSPORT, Value: transport}, nil
+	}
+	return Match{}, fmt.Errorf("unknown journal transport %q", transport)
+}
+
+// MatchSystemdUnit returns a match selecting entries logged by the given unit,
+// whose name must include its type suffix, e.g. "sshd.service".
+func MatchSystemdUnit(unit string) (Match, error) {
+	if !strings.Contains(unit, ".") || strings.HasPrefix(unit, ".") || strings.HasSuffix(unit, ".") {
+		return Match{}, fmt.Errorf("invalid unit name %q: must include a unit type suffix", unit)
+	}
+	return Match{Field: SD_JOURNAL_FIELD_SYSTEMD_UNIT, Value: unit}, nil
+}
+
+// MatchPriority returns a match selecting entries with the given syslog(3)
+// priority, from 0 (emerg) to 7 (debug).
+func MatchPriority(priority int) (Match, error) {
+	matches, err := MatchPriorityRange(priority, priority)
+	if err != nil {
+		return Match{}, err
+	}
+	return matches[0], nil
+}
+
+// MatchPriorityRange returns the matches selecting entries whose PRIORITY lies
+// within the inclusive range [min, max]. Priorities follow syslog(3), from 0
+// (emerg) to 7 (debug). Matches on the same field are OR'ed by the journal, so
+// the result can be passed to AddMatch or JournalReaderConfig.Matches as is.
+func MatchPriorityRange(min, max int) ([]Match, error) {
+	if min < 0 || max > 7 || min > max {
+		return nil, fmt.Errorf("invalid priority range %d-%d: must be within 0-7", min, max)
+	}
+
+	matches := make([]Match, 0, max-min+1)
+	for p := min; p <= max; p++ {
+		matches = append(matches, Match{
+			Field: SD_JOURNAL_FIELD_PRIORITY,
+			Value: strconv.Itoa(p),
+		})
+	}
+
+	return matches, nil
+}
+
+// MatchExpression builds a match expression of the form
+// (A OR B) AND (C OR D), to be added to a journal with AddMatchExpression.
+// It is made of groups ANDed together, each of them a list of alternatives
+// ORed together, each alternative in turn requiring all of its matches:
+//
+//	var e MatchExpression
+//	e.Or(a).Or(b).And().Or(c).Or(d)
+//
+// The zero value is an empty expression, matching all entries.
+type MatchExpression struct {
+	groups [][][]Match
+}
+
+// Or adds an alternative to the current group of the expression, matching the
+// entries that satisfy all of the given matches. As the journal ORs matches on
+// the same field, the matches of an alternative must be on different fields;
+// AddMatchExpression rejects the expression otherwise.
+func (e *MatchExpression) Or(matches ...Match) *MatchExpression {
+	if len(e.groups) == 0 {
+		e.groups = append(e.groups, nil)
+	}
+	i := len(e.groups) - 1
+	e.groups[i] = append(e.groups[i], matches)
+	return e
+}
+
+// And closes the current group of the expression, so that alternatives added
+// next make up a new group ANDed with the previous ones.
+func (e *MatchExpression) And() *MatchExpression {
+	if len(e.groups) > 0 && len(e.groups[len(e.groups)-1]) > 0 {
+		e.groups = append(e.groups, nil)
+	}
+	return e
+}
+
+// String returns a human readable representation of the expression, e.g.
+// (A=a OR B=b) AND (C=c OR D=d).
+func (e *MatchExpression) String() string {
+	var groups []string
+	for _, group := range e.groups {
+		if len(group) == 0 {
+			continue
+		}
+		var terms []string
+		for _, term := range group {
+			var matches []string
+			for _, m := range term {
+				matches = append(matches, m.String())
+			}
+			terms = append(terms, strings.Join(matches, " AND "))
+		}
+		groups = append(groups, "("+strings.Join(terms, " OR ")+")")
+	}
+	return strings.Join(groups, " AND ")
+}
+
+// validate makes sure that no alternative of e has two matches on the same
+// field, which the journal would OR rather than AND.
+func (e *MatchExpression) validate() error {
+	for _, group := range e.groups {
+		for _, term := range group {
+			fields := make(map[string]bool, len(term))
+			for _, m := range term {
+				if fields[m.Field] {
+					return fmt.Errorf("match expression alternative has several matches on %s, which the journal would OR", m.Field)
+				}
+				fields[m.Field] = true
+			}
+		}
+	}
+	return nil
+}
+
 // NewJournal returns a new Journal instance pointing to the local journal
 func NewJournal() (*Journal, error) {
+	return NewJournalWithFlags(SD_JOURNAL_LOCAL_ONLY)
+}
+
+// NewJournalWithFlags returns a new Journal instance pointing to the journal
+// files selected by flags, a combination of SD_JOURNAL_LOCAL_ONLY,
+// SD_JOURNAL_RUNTIME_ONLY, SD_JOURNAL_SYSTEM and SD_JOURNAL_CURRENT_USER. A
+// value of 0 opens all the journal files available.
+func NewJournalWithFlags(flags int) (*Journal, error) {
 	j := &Journal{}
-	r := C.sd_journal_open(&j.cjournal, C.SD_JOURNAL_LOCAL_ONLY)
+	r := C.sd_journal_open(&j.cjournal, C.int(flags))
 
 	if r < 0 {
 		return nil, fmt.Errorf("failed to open journal: %d", r)
@@ -101,6 +478,25 @@ func NewJournal() (*Journal, error) {
 	return j, nil
 }
 
+// NewJournalFromNamespace returns a new Journal instance pointing to the local
+// journal of the given namespace, as configured with LogNamespace= in a unit.
+// It requires systemd 245 or newer.
+func NewJournalFromNamespace(namespace string) (*Journal, error) {
+	ns := C.CString(namespace)
+	defer C.free(unsafe.Pointer(ns))
+
+	j := &Journal{}
+	r := C.my_sd_journal_open_namespace(&j.cjournal, ns, C.SD_JOURNAL_LOCAL_ONLY)
+	if r == -C.ENOSYS {
+		return nil, fmt.Errorf("failed to open journal namespace %q: not supported by libsystemd", namespace)
+	}
+	if r < 0 {
+		return nil, fmt.Errorf("failed to open journal namespace %q: %d", namespace, r)
+	}
+
+	return j, nil
+}
+
 // NewJournalFromDir returns a new Journal instance pointing to a journal residing
 // in a given directory. The supplied path may be relative or absolute; if
 // relative, it will be converted to an absolute path before being opened.
@@ -122,17 +518,64 @@ func NewJournalFromDir(path string) (*Journal, error) {
 	return j, nil
 }
 
+// NewJournalFromFiles returns a new Journal instance reading the given journal
+// files as a single interleaved stream.
+func NewJournalFromFiles(paths ...string) (*Journal, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("failed to open journal files: no files given")
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("failed to open journal file %q: %v", path, err)
+		}
+	}
+
+	// sd_journal_open_files expects a NULL-terminated array of paths
+	cpaths := make([]*C.char, len(paths)+1)
+	for i, path := range paths {
+		cpaths[i] = C.CString(path)
+		defer C.free(unsafe.Pointer(cpaths[i]))
+	}
+	carray := (**C.char)(C.malloc(C.size_t(len(cpaths)) * C.size_t(unsafe.Sizeof(cpaths[0]))))
+	defer C.free(unsafe.Pointer(carray))
+	n := len(cpaths)
+	copy((*[1 << 28]*C.char)(unsafe.Pointer(carray))[:n:n], cpaths)
+
+	j := &Journal{}
+	r := C.sd_journal_open_files(&j.cjournal, carray, 0)
+	if r < 0 {
+		return nil, fmt.Errorf("failed to open journal files %q: %d", paths, r)
+	}
+
+	return j, nil
+}
+
 // Close closes a journal opened with NewJournal.
 func (j *Journal) Close() error {
 	j.mu.Lock()
 	C.sd_journal_close(j.cjournal)
+	// sd-journal calls reject a NULL journal, so any later use fails cleanly
+	j.cjournal = nil
+	if !j.closed {
+		j.closed = true
+		if j.done != nil {
+			close(j.done)
+		}
+	}
 	j.mu.Unlock()
 
 	return nil
 }
 
-// AddMatch adds a match by which to filter the entries of the journal.
+// AddMatch adds a match by which to filter the entries of the journal. The
+// match must be of the form FIELD=value, where the field name consists of
+// uppercase letters, digits and underscores only, and does not start with a
+// digit.
 func (j *Journal) AddMatch(match string) error {
+	if _, err := ParseMatch(match); err != nil {
+		return err
+	}
+
 	m := C.CString(match)
 	defer C.free(unsafe.Pointer(m))
 
@@ -147,7 +590,54 @@ func (j *Journal) AddMatch(match string) error {
 	return nil
 }
 
+// validFieldName reports whether name is a valid journal field name, per
+// http://www.freedesktop.org/software/systemd/man/systemd.journal-fields.html
+func validFieldName(name string) bool {
+	if len(name) == 0 || len(name) > 64 {
+		return false
+	}
+	if '0' <= name[0] && name[0] <= '9' {
+		return false
+	}
+	for _, c := range name {
+		if !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// validID128 reports whether id is a 128-bit ID formatted as 32 hexadecimal
+// characters, as used for boot and machine IDs.
+func validID128(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	for _, c := range id {
+		if !('0' <= c && c <= '9') && !('a' <= c && c <= 'f') && !('A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
 // AddDisjunction inserts a logical OR in the match list.
+//
+// Matches added with AddMatch are ANDed together, save for matches on the
+// same field which are ORed. AddDisjunction ORs the matches added so far with
+// those added next, and AddConjunction in turn ANDs everything added so far,
+// disjunctions included, with what follows. (A OR B) AND (C OR D) is therefore
+// built with:
+//
+//	j.AddMatch(A)
+//	j.AddDisjunction()
+//	j.AddMatch(B)
+//	j.AddConjunction()
+//	j.AddMatch(C)
+//	j.AddDisjunction()
+//	j.AddMatch(D)
+//
+// See AddMatchExpression for a simpler way of building such queries.
 func (j *Journal) AddDisjunction() error {
 	j.mu.Lock()
 	r := C.sd_journal_add_disjunction(j.cjournal)
@@ -180,6 +670,45 @@ func (j *Journal) FlushMatches() {
 	j.mu.Unlock()
 }
 
+// AddMatchExpression adds the matches, disjunctions and conjunctions making up
+// e to the match list. Matches already in the list are ANDed with the first
+// alternative of e, so it is best used on a journal without other matches, or
+// after FlushMatches. An alternative with several matches on the same field
+// is rejected before any match is added.
+func (j *Journal) AddMatchExpression(e *MatchExpression) error {
+	if err := e.validate(); err != nil {
+		return err
+	}
+
+	first := true
+	for _, group := range e.groups {
+		if len(group) == 0 {
+			continue
+		}
+		if !first {
+			if err := j.AddConjunction(); err != nil {
+				return err
+			}
+		}
+		first = false
+
+		for i, term := range group {
+			if i > 0 {
+				if err := j.AddDisjunction(); err != nil {
+					return err
+				}
+			}
+			for _, m := range term {
+				if err := j.AddMatch(m.String()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
 // Next advances the read pointer into the journal by one entry.
 func (j *Journal) Next() (int, error) {
 	j.mu.Lock()
@@ -244,13 +773,15 @@ func (j *Journal) GetData(field string) (string, error) {
 	var l C.size_t
 
 	j.mu.Lock()
-	r := C.sd_journal_get_data(j.cjournal, f, &d, &l)
-	j.mu.Unlock()
+	defer j.mu.Unlock()
 
+	r := C.sd_journal_get_data(j.cjournal, f, &d, &l)
 	if r < 0 {
 		return "", fmt.Errorf("failed to read message: %d", r)
 	}
 
+	// The data is only valid until the next call on the journal, so copy
+	// it while still holding the lock
 	msg := C.GoStringN((*C.char)(d), C.int(l))
 
 	return msg, nil
@@ -267,6 +798,12 @@ func splitNameValue(fieldData []byte) (string, []byte) {
 	}
 	return "", []byte{}
 }
+
+// addToMap adds a value of the field name to hashmap. Fields are stored as a
+// string, or as []byte when not valid UTF-8, and turn into a []string or
+// [][]byte once repeated, so that no value is lost. A field holding both
+// kinds of values is stored as [][]byte. A value of any other type, which
+// addToMap did not store, is left untouched.
 func addToMap(hashmap JournalEntry, name string, value []byte) {
 	v, ok := hashmap[name]
 	if !ok {
@@ -276,27 +813,98 @@ func addToMap(hashmap JournalEntry, name string, value []byte) {
 		} else {
 			hashmap[name] = value
 		}
-	} else {
-		// if the field does exist, make it a slice and append
-		switch t := v.(type) {
-		default:
-			fmt.Printf("Unexpected type: %T\n", t)
-		case string:
-			// NOTE: it is assumed here that consecutive fields with the same name are also UTF-8 strings
+		return
+	}
+
+	// if the field does exist, make it a slice and append
+	switch t := v.(type) {
+	case string:
+		if utf8.Valid(value) {
 			hashmap[name] = []string{t, string(value)}
-		case []byte:
-			hashmap[name] = [][]byte{t, value}
-		case []string:
-			// NOTE: it is assumed here that consecutive fields with the same name are also UTF-8 strings
+		} else {
+			hashmap[name] = [][]byte{[]byte(t), value}
+		}
+	case []byte:
+		hashmap[name] = [][]byte{t, value}
+	case []string:
+		if utf8.Valid(value) {
 			hashmap[name] = append(t, string(value))
-		case [][]byte:
-			hashmap[name] = append(t, value)
+		} else {
+			values := make([][]byte, len(t), len(t)+1)
+			for i, s := range t {
+				values[i] = []byte(s)
+			}
+			hashmap[name] = append(values, value)
 		}
+	case [][]byte:
+		hashmap[name] = append(t, value)
 	}
 }
 
+// GetDataAll returns all the fields of the current journal entry, along with
+// its cursor, timestamps and boot ID. If the entry has a MESSAGE_ID found in
+// the message catalog, the catalog text is stored under CATALOG_ENTRY; see
+// GetCatalog. Fields larger than the data threshold are truncated; see
+// SetDataThreshold. The fields are read in a single pass over the entry,
+// which is much cheaper than looking them up one by one with GetData. With
+// systemd >= 246, fields which cannot be read, e.g. as they use an
+// unsupported compression, are skipped.
 func (j *Journal) GetDataAll() (JournalEntry, error) {
 	data := make(JournalEntry)
+	if err := j.getDataAll(data); err != nil {
+		return nil, err
+	}
+
+	j.addCatalogEntry(data)
+
+	return data, nil
+}
+
+// addCatalogEntry adds the catalog text of the current entry to data under
+// CATALOG_ENTRY, if data has a MESSAGE_ID found in the message catalog.
+func (j *Journal) addCatalogEntry(data JournalEntry) {
+	if _, ok := data["MESSAGE_ID"]; ok {
+		catalogEntry, err := j.GetCatalog()
+		if err == nil {
+			data["CATALOG_ENTRY"] = catalogEntry
+		}
+	}
+}
+
+// GetDataAllMulti returns all the fields of the current journal entry, each
+// with all of its values in the order they appear in the entry, as fields may
+// be repeated. Unlike GetDataAll, values are always strings, holding the raw
+// bytes of values that are not valid UTF-8, and the cursor, timestamps and
+// boot ID are not included.
+func (j *Journal) GetDataAllMulti() (map[string][]string, error) {
+	var d unsafe.Pointer
+	var l C.size_t
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	data := make(map[string][]string)
+	C.sd_journal_restart_data(j.cjournal)
+	for {
+		r := C.my_sd_journal_enumerate_available_data(j.cjournal, &d, &l)
+		if r < 0 {
+			return nil, fmt.Errorf("failed to read message field: %d", r)
+		}
+		if r == 0 {
+			return data, nil
+		}
+
+		name, value := splitNameValue(C.GoBytes(d, C.int(l)))
+		data[name] = append(data[name], string(value))
+	}
+}
+
+// getDataAll works like GetDataAll, but stores the fields in data, which is
+// emptied first.
+func (j *Journal) getDataAll(data JournalEntry) error {
+	for name := range data {
+		delete(data, name)
+	}
 
 	var d unsafe.Pointer
 	var l C.size_t
@@ -306,9 +914,13 @@ func (j *Journal) GetDataAll() (JournalEntry, error) {
 	var crealtime C.uint64_t
 	var cmonotonic C.uint64_t
 	var ccursor *C.char
+
+	// Hold the lock throughout so that the read pointer cannot be moved
+	// while the entry is being read
 	j.mu.Lock()
+	defer j.mu.Unlock()
+
 	// not in their own fields
-	C.sd_journal_set_data_threshold(j.cjournal, 0)
 	C.sd_journal_get_realtime_usec(j.cjournal, &crealtime)
 	C.sd_journal_get_monotonic_usec(j.cjournal, &cmonotonic, &cboot_id)
 	C.sd_id128_to_string(cboot_id, csid)
@@ -317,7 +929,6 @@ func (j *Journal) GetDataAll() (JournalEntry, error) {
 
 	// reset to start the loop
 	C.sd_journal_restart_data(j.cjournal)
-	j.mu.Unlock()
 
 	realtime := uint64(crealtime)
 	monotonic := uint64(cmonotonic)
@@ -331,12 +942,11 @@ func (j *Journal) GetDataAll() (JournalEntry, error) {
 
 	for {
 		// retrieve new field
-		j.mu.Lock()
-		r := C.sd_journal_enumerate_data(j.cjournal, &d, &l)
-		j.mu.Unlock()
-
-		if r <= 0 {
-
+		r := C.my_sd_journal_enumerate_available_data(j.cjournal, &d, &l)
+		if r < 0 {
+			return fmt.Errorf("failed to read message field: %d", r)
+		}
+		if r == 0 {
 			break
 		}
 
@@ -345,16 +955,95 @@ func (j *Journal) GetDataAll() (JournalEntry, error) {
 		addToMap(data, name, value)
 	}
 
-	// Add catalog data as well if there is a MESSAGE_ID
-	_, ok := data["MESSAGE_ID"]
-	if ok {
-		catalogEntry, err := j.GetCatalog()
-		if err == nil {
-			data["CATALOG_ENTRY"] = catalogEntry
+	return nil
+}
+
+// GetDataBytes works like GetData, but appends the data object to buf and
+// returns the extended slice rather than allocating a new string, so that a
+// buffer can be reused across calls.
+func (j *Journal) GetDataBytes(field string, buf []byte) ([]byte, error) {
+	f := C.CString(field)
+	defer C.free(unsafe.Pointer(f))
+
+	var d unsafe.Pointer
+	var l C.size_t
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	r := C.sd_journal_get_data(j.cjournal, f, &d, &l)
+	if r < 0 {
+		return buf, fmt.Errorf("failed to read message: %d", r)
+	}
+
+	// The data is only valid until the next call on the journal, so it is
+	// viewed in place and copied into buf
+	return append(buf, (*[1 << 30]byte)(d)[:l:l]...), nil
+}
+
+// GetDataAllBytes returns the data objects of all the fields of the current
+// journal entry, each of the form FIELD=value. The slices in bufs, and their
+// capacity, are reused to hold the data so that entries can be read without
+// allocating once the buffers have grown large enough. Unlike GetDataAll, no
+// cursor, timestamp or boot ID is included.
+func (j *Journal) GetDataAllBytes(bufs [][]byte) ([][]byte, error) {
+	var d unsafe.Pointer
+	var l C.size_t
+
+	bufs = bufs[:0]
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	C.sd_journal_restart_data(j.cjournal)
+	for {
+		r := C.my_sd_journal_enumerate_available_data(j.cjournal, &d, &l)
+		if r < 0 {
+			return bufs, fmt.Errorf("failed to read message field: %d", r)
+		}
+		if r == 0 {
+			return bufs, nil
+		}
+
+		// The data is only valid until the next call on the journal, so it
+		// is viewed in place and copied into bufs
+		data := (*[1 << 30]byte)(d)[:l:l]
+		if n := len(bufs); n < cap(bufs) {
+			bufs = bufs[:n+1]
+			bufs[n] = append(bufs[n][:0], data...)
+		} else {
+			bufs = append(bufs, append([]byte(nil), data...))
 		}
 	}
+}
 
-	return data, nil
+// GetEntrySize returns the number of fields of the current journal entry and
+// their total size in bytes, as FIELD=value data objects, binary fields
+// included, without copying them. Sizes are limited by the data threshold
+// like the data returned by GetData. Like GetDataAll, fields which cannot be
+// read are skipped with systemd >= 246.
+func (j *Journal) GetEntrySize() (int, uint64, error) {
+	var d unsafe.Pointer
+	var l C.size_t
+	var fields int
+	var size uint64
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	C.sd_journal_restart_data(j.cjournal)
+	for {
+		r := C.my_sd_journal_enumerate_available_data(j.cjournal, &d, &l)
+		if r < 0 {
+			return 0, 0, fmt.Errorf("failed to read message field: %d", r)
+		}
+		if r == 0 {
+			return fields, size, nil
+		}
+
+		fields++
+		size += uint64(l)
+	}
 }
 
 // GetDataValue gets the data object associated with a specific field from the
@@ -367,10 +1056,13 @@ func (j *Journal) GetDataValue(field string) (string, error) {
 	return strings.SplitN(val, "=", 2)[1], nil
 }
 
-// SetDataThresold sets the data field size threshold for data returned by
-// GetData. To retrieve the complete data fields this threshold should be
-// turned off by setting it to 0, so that the library always returns the
-// complete data objects.
+// SetDataThreshold sets the data field size threshold for data returned by
+// GetData and the other data accessors: larger fields are truncated to
+// about that many bytes. A threshold of 0 means unbounded, so that the
+// library always returns the complete data objects. The threshold applies to
+// all reads until changed, so a single large field can be read in full by
+// saving the threshold with GetDataThreshold, setting it to 0, and restoring
+// it afterwards.
 func (j *Journal) SetDataThreshold(threshold uint64) error {
 	j.mu.Lock()
 	r := C.sd_journal_set_data_threshold(j.cjournal, C.size_t(threshold))
@@ -383,6 +1075,23 @@ func (j *Journal) SetDataThreshold(threshold uint64) error {
 	return nil
 }
 
+// GetDataThreshold returns the data field size threshold set by
+// SetDataThreshold, 0 meaning unbounded. Unless changed, sd-journal uses a
+// threshold of 64KiB.
+func (j *Journal) GetDataThreshold() (uint64, error) {
+	var sz C.size_t
+
+	j.mu.Lock()
+	r := C.sd_journal_get_data_threshold(j.cjournal, &sz)
+	j.mu.Unlock()
+
+	if r < 0 {
+		return 0, fmt.Errorf("failed to get data threshold: %d", r)
+	}
+
+	return uint64(sz), nil
+}
+
 // GetRealtimeUsec gets the realtime (wallclock) timestamp of the current
 // journal entry.
 func (j *Journal) GetRealtimeUsec() (uint64, error) {
@@ -399,7 +1108,56 @@ func (j *Journal) GetRealtimeUsec() (uint64, error) {
 	return uint64(usec), nil
 }
 
-//SeekHead seeks to the beginning of the journal, i.e. the oldest available entry.
+// GetSeqnum returns the sequence number of the current journal entry, along
+// with the ID of the sequence it belongs to. Within one sequence ID, entries
+// are numbered contiguously, so a gap between the seqnums of consecutive
+// entries means entries were lost or rotated away, while a change of
+// sequence ID means numbering restarted, e.g. after the journal files were
+// recreated. It requires systemd 254 or newer, and returns
+// ErrSeqnumNotSupported otherwise.
+func (j *Journal) GetSeqnum() (uint64, string, error) {
+	var seqnum C.uint64_t
+	var cseqnum_id C.sd_id128_t
+	var csid = C.CString("123456789012345678901234567890123")
+	defer C.free(unsafe.Pointer(csid))
+
+	j.mu.Lock()
+	r := C.my_sd_journal_get_seqnum(j.cjournal, &seqnum, &cseqnum_id)
+	j.mu.Unlock()
+
+	if r == -C.ENOSYS {
+		return 0, "", ErrSeqnumNotSupported
+	}
+	if r < 0 {
+		return 0, "", fmt.Errorf("error getting seqnum for entry: %d", r)
+	}
+
+	C.sd_id128_to_string(cseqnum_id, csid)
+	return uint64(seqnum), C.GoString(csid), nil
+}
+
+// GetMonotonicUsec gets the monotonic timestamp of the current journal entry,
+// along with the ID of the boot it is relative to.
+func (j *Journal) GetMonotonicUsec() (uint64, string, error) {
+	var usec C.uint64_t
+	var cboot_id C.sd_id128_t
+	var csid = C.CString("123456789012345678901234567890123")
+	defer C.free(unsafe.Pointer(csid))
+
+	j.mu.Lock()
+	r := C.sd_journal_get_monotonic_usec(j.cjournal, &usec, &cboot_id)
+	j.mu.Unlock()
+
+	if r < 0 {
+		return 0, "", fmt.Errorf("error getting monotonic timestamp for entry: %d", r)
+	}
+
+	C.sd_id128_to_string(cboot_id, csid)
+
+	return uint64(usec), C.GoString(csid), nil
+}
+
+// SeekHead seeks to the beginning of the journal, i.e. the oldest available entry.
 func (j *Journal) SeekHead() error {
 	j.mu.Lock()
 	r := C.sd_journal_seek_head(j.cjournal)
@@ -523,13 +1281,32 @@ func (j *Journal) TestCursor(cursor string) (bool, error) {
 	return true, nil
 }
 
+// SeekCursorAndNext seeks to the entry located at the specified cursor string
+// and moves the read pointer onto it, so that it can be read right away. It
+// returns true if that is the exact entry the cursor refers to, or false if
+// it was not found and the read pointer is on the next closest entry instead.
+func (j *Journal) SeekCursorAndNext(cursor string) (bool, error) {
+	if err := j.SeekCursor(cursor); err != nil {
+		return false, err
+	}
+
+	// Seeking does not update the read pointer until it is advanced
+	if _, err := j.Next(); err != nil {
+		return false, err
+	}
+
+	return j.TestCursor(cursor)
+}
+
 // GetCatalog retrieves a message catalog entry for the current journal entry.
 // This will look up an entry in the message catalog by using the "MESSAGE_ID="
 // field of the current journal entry. Before returning the entry all journal
 // field names in the catalog entry text enclosed in "@" will be replaced by the
 // respective field values of the current entry. If a field name referenced in
 // the message catalog entry does not exist, in the current journal entry, the
-// "@" will be removed, but the field name otherwise left untouched.
+// "@" will be removed, but the field name otherwise left untouched. If the
+// entry has no MESSAGE_ID or it is not in the catalog, ErrNoCatalogEntry is
+// returned.
 func (j *Journal) GetCatalog() (string, error) {
 	var ccatalog *C.char
 
@@ -539,6 +1316,9 @@ func (j *Journal) GetCatalog() (string, error) {
 
 	defer C.free(unsafe.Pointer(ccatalog))
 
+	if r == -C.ENOENT {
+		return "", ErrNoCatalogEntry
+	}
 	if r < 0 {
 		return "", fmt.Errorf("failed to retrieve catalog entry for current journal entry: %d", r)
 	}
@@ -575,22 +1355,354 @@ func GetCatalogForMessageID(messageId string) (string, error) {
 // Wait will synchronously wait until the journal gets changed. The maximum time
 // this call sleeps may be controlled with the timeout parameter.  If
 // sdjournal.IndefiniteWait is passed as the timeout parameter, Wait will
-// wait indefinitely for a journal change.
+// wait indefinitely for a journal change. Like WaitContext, Wait does not
+// lock the journal while waiting; closing it makes Wait return -EINVAL, as
+// calls on a closed journal do.
 func (j *Journal) Wait(timeout time.Duration) int {
-	var to uint64
-	if timeout == IndefiniteWait {
-		// sd_journal_wait(3) calls for a (uint64_t) -1 to be passed to signify
-		// indefinite wait, but using a -1 overflows our C.uint64_t, so we use an
-		// equivalent hex value.
-		to = 0xffffffffffffffff
-	} else {
-		to = uint64(time.Now().Add(timeout).Unix() / 1000)
+	return int(j.wait(timeout, nil))
+}
+
+// GetUniqueValues returns all the distinct values the given field takes across
+// the journal files that are open, irrespective of the matches added.
+func (j *Journal) GetUniqueValues(field string) ([]string, error) {
+	var values []string
+	err := j.EnumerateUniqueValues(field, func(value string) error {
+		values = append(values, value)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+
+	return values, nil
+}
+
+// EnumerateUniqueValues works like GetUniqueValues, but calls fn with each
+// value rather than collecting them, so that fields taking many values can be
+// processed without holding them all in memory. Enumeration stops at the first
+// error returned by fn, which is then returned.
+func (j *Journal) EnumerateUniqueValues(field string, fn func(value string) error) error {
+	f := C.CString(field)
+	defer C.free(unsafe.Pointer(f))
+
 	j.mu.Lock()
-	r := C.sd_journal_wait(j.cjournal, C.uint64_t(to))
+	r := C.sd_journal_query_unique(j.cjournal, f)
+	C.sd_journal_restart_unique(j.cjournal)
 	j.mu.Unlock()
 
-	return int(r)
+	if r < 0 {
+		return fmt.Errorf("failed to query unique values of field %s: %d", field, r)
+	}
+
+	var d unsafe.Pointer
+	var l C.size_t
+
+	for {
+		j.mu.Lock()
+		r := C.sd_journal_enumerate_unique(j.cjournal, &d, &l)
+		var data []byte
+		if r > 0 {
+			data = C.GoBytes(d, C.int(l))
+		}
+		j.mu.Unlock()
+
+		if r < 0 {
+			return fmt.Errorf("failed to enumerate unique values of field %s: %d", field, r)
+		}
+		if r == 0 {
+			return nil
+		}
+
+		// Values are returned as FIELD=value
+		_, value := splitNameValue(data)
+		if err := fn(string(value)); err != nil {
+			return err
+		}
+	}
+}
+
+// Fields returns the names of all the fields used across the journal files
+// that are open, irrespective of the matches added.
+func (j *Journal) Fields() ([]string, error) {
+	var fields []string
+	var f *C.char
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	C.sd_journal_restart_fields(j.cjournal)
+	for {
+		r := C.sd_journal_enumerate_fields(j.cjournal, &f)
+		if r < 0 {
+			return nil, fmt.Errorf("failed to enumerate fields: %d", r)
+		}
+		if r == 0 {
+			return fields, nil
+		}
+
+		fields = append(fields, C.GoString(f))
+	}
+}
+
+// Boot describes one of the boots recorded in the journal, as listed by
+// journalctl --list-boots.
+type Boot struct {
+	// Index of the boot relative to the most recent one in the journal:
+	// 0 for the most recent boot, -1 for the one before it, and so on.
+	Index         int
+	BootID        string
+	FirstRealtime time.Time // timestamp of the first entry of the boot
+	LastRealtime  time.Time // timestamp of the last entry of the boot
+}
+
+// ListBoots returns the boots recorded in the journal, oldest first. Each
+// boot's time range is found by seeking to its first and last entries, so
+// ListBoots flushes the matches added to the journal and leaves the read
+// pointer at an arbitrary position: matches must be added, and the read
+// pointer positioned, anew afterwards.
+func (j *Journal) ListBoots() ([]Boot, error) {
+	ids, err := j.GetUniqueValues(SD_JOURNAL_FIELD_BOOT_ID)
+	if err != nil {
+		return nil, err
+	}
+	defer j.FlushMatches()
+
+	boots := make([]Boot, 0, len(ids))
+	for _, id := range ids {
+		j.FlushMatches()
+		if err := j.AddMatch(SD_JOURNAL_FIELD_BOOT_ID + "=" + id); err != nil {
+			return nil, err
+		}
+
+		first, err := j.bootBound(j.SeekHead, func() (uint64, error) {
+			c, err := j.Next()
+			return uint64(c), err
+		})
+		if err != nil {
+			return nil, err
+		}
+		last, err := j.bootBound(j.SeekTail, j.Previous)
+		if err != nil {
+			return nil, err
+		}
+		// Entries of a boot may have been vacuumed meanwhile
+		if first.IsZero() || last.IsZero() {
+			continue
+		}
+
+		boots = append(boots, Boot{BootID: id, FirstRealtime: first, LastRealtime: last})
+	}
+
+	indexBoots(boots)
+	return boots, nil
+}
+
+// bootBound seeks to an end of the entries matched, then steps onto the
+// entry there and returns its timestamp, or the zero time if there is none.
+func (j *Journal) bootBound(seek func() error, step func() (uint64, error)) (time.Time, error) {
+	if err := seek(); err != nil {
+		return time.Time{}, err
+	}
+	c, err := step()
+	if err != nil || c == 0 {
+		return time.Time{}, err
+	}
+	usec, err := j.GetRealtimeUsec()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, int64(usec)*int64(time.Microsecond)), nil
+}
+
+// indexBoots sorts boots by their first entry and numbers them relative to the
+// most recent one.
+func indexBoots(boots []Boot) {
+	sort.Sort(byFirstRealtime(boots))
+	for i := range boots {
+		boots[i].Index = i - (len(boots) - 1)
+	}
+}
+
+// byFirstRealtime sorts boots by their first entry.
+type byFirstRealtime []Boot
+
+func (b byFirstRealtime) Len() int           { return len(b) }
+func (b byFirstRealtime) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byFirstRealtime) Less(i, j int) bool { return b[i].FirstRealtime.Before(b[j].FirstRealtime) }
+
+// findBoot returns the boot with the given offset: 0 or a negative one is
+// relative to the most recent boot, as in Boot.Index, while a positive one
+// counts from the oldest boot, 1 being the oldest, as with journalctl -b.
+func findBoot(boots []Boot, offset int) (Boot, error) {
+	i := offset - 1
+	if offset <= 0 {
+		i = len(boots) - 1 + offset
+	}
+	if i < 0 || i >= len(boots) {
+		return Boot{}, fmt.Errorf("no boot with offset %d in the journal", offset)
+	}
+	return boots[i], nil
+}
+
+// GetFd returns a file descriptor that may be polled in an external event
+// loop to wait for journal changes, instead of calling Wait. Once it becomes
+// ready, Process must be called before reading from the journal again, and
+// data previously returned by GetData must be read anew. The descriptor is
+// owned by the journal and closed along with it.
+func (j *Journal) GetFd() (int, error) {
+	j.mu.Lock()
+	r := C.sd_journal_get_fd(j.cjournal)
+	j.mu.Unlock()
+
+	if r < 0 {
+		return 0, fmt.Errorf("failed to get journal file descriptor: %d", r)
+	}
+
+	return int(r), nil
+}
+
+// GetEvents returns the poll(2) events, such as POLLIN, to wait for on the
+// file descriptor returned by GetFd.
+func (j *Journal) GetEvents() (int, error) {
+	j.mu.Lock()
+	r := C.sd_journal_get_events(j.cjournal)
+	j.mu.Unlock()
+
+	if r < 0 {
+		return 0, fmt.Errorf("failed to get journal poll events: %d", r)
+	}
+
+	return int(r), nil
+}
+
+// GetTimeout returns the CLOCK_MONOTONIC time, in microseconds, by which
+// Process should be called even if the file descriptor returned by GetFd did
+// not become ready. A value of math.MaxUint64 means no timeout is needed.
+func (j *Journal) GetTimeout() (uint64, error) {
+	var usec C.uint64_t
+
+	j.mu.Lock()
+	r := C.sd_journal_get_timeout(j.cjournal, &usec)
+	j.mu.Unlock()
+
+	if r < 0 {
+		return 0, fmt.Errorf("failed to get journal timeout: %d", r)
+	}
+
+	return uint64(usec), nil
+}
+
+// Process processes the events signalled on the file descriptor returned by
+// GetFd, returning one of SD_JOURNAL_NOP, SD_JOURNAL_APPEND or
+// SD_JOURNAL_INVALIDATE.
+func (j *Journal) Process() (int, error) {
+	j.mu.Lock()
+	r := C.sd_journal_process(j.cjournal)
+	j.mu.Unlock()
+
+	if r < 0 {
+		return int(r), fmt.Errorf("failed to process journal events: %d", r)
+	}
+
+	return int(r), nil
+}
+
+// WaitContext works like Wait, but instead of a timeout it waits until ctx is
+// done, in which case it returns ctx.Err(). The journal is not locked while
+// waiting, so that it can be used from other goroutines meanwhile; closing it
+// makes WaitContext return ErrJournalClosed.
+func (j *Journal) WaitContext(ctx context.Context) (int, error) {
+	r := j.wait(IndefiniteWait, ctx.Done())
+	if r < 0 {
+		select {
+		case <-j.closing():
+			return 0, ErrJournalClosed
+		default:
+		}
+	}
+	if r == -C.ECANCELED {
+		return 0, ctx.Err()
+	}
+	if r < 0 {
+		return int(r), fmt.Errorf("failed to wait for journal changes: %d", r)
+	}
+
+	return int(r), nil
+}
+
+// wait works like sd_journal_wait, but only holds the lock while using the
+// journal, not while polling, so that other calls, and Close in particular,
+// are not held up. It returns -EINVAL once the journal is closed, and
+// -ECANCELED once cancel is closed.
+func (j *Journal) wait(timeout time.Duration, cancel <-chan struct{}) C.int {
+	// Cancellation is signalled to the poll(2) call through a pipe
+	var p [2]int
+	if err := syscall.Pipe2(p[:], syscall.O_CLOEXEC); err != nil {
+		return -C.int(err.(syscall.Errno))
+	}
+
+	closing := j.closing()
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-cancel:
+		case <-closing:
+		case <-stop:
+			return
+		}
+		syscall.Write(p[1], []byte{0})
+	}()
+	defer func() {
+		close(stop)
+		<-stopped
+		syscall.Close(p[0])
+		syscall.Close(p[1])
+	}()
+
+	var fd, events, ctimeout C.int
+	j.mu.Lock()
+	if j.closed {
+		j.mu.Unlock()
+		return -C.EINVAL
+	}
+	r := C.my_sd_journal_wait_params(j.cjournal, &fd, &events, &ctimeout)
+	j.mu.Unlock()
+	if r < 0 {
+		return r
+	}
+
+	// Like sd_journal_wait, wake up for whichever timeout comes first
+	if timeout != IndefiniteWait {
+		ms := (timeout + time.Millisecond - 1) / time.Millisecond
+		if ms < 0 {
+			ms = 0
+		}
+		if ms <= math.MaxInt32 && (ctimeout < 0 || C.int(ms) < ctimeout) {
+			ctimeout = C.int(ms)
+		}
+	}
+
+	r = C.my_poll_cancellable(fd, events, C.int(p[0]), ctimeout)
+	if r == -C.ECANCELED {
+		select {
+		case <-closing:
+			return -C.EINVAL
+		default:
+		}
+		return r
+	}
+	if r < 0 {
+		return r
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.closed {
+		return -C.EINVAL
+	}
+	return C.sd_journal_process(j.cjournal)
 }
 
 // GetUsage returns the journal disk space usage, in bytes.
@@ -16,7 +16,19 @@
 package sdjournal
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -90,3 +102,1542 @@ func TestJournalGetUsage(t *testing.T) {
 		t.Fatalf("Error getting journal size: %s", err)
 	}
 }
+
+func TestJournalReaderConflictingStart(t *testing.T) {
+	_, err := NewJournalReader(JournalReaderConfig{
+		SeekHead:    true,
+		NumFromTail: 10,
+	})
+
+	if err == nil {
+		t.Fatal("Expected an error when combining SeekHead and NumFromTail")
+	}
+}
+
+func TestMatchPriorityRange(t *testing.T) {
+	matches, err := MatchPriorityRange(2, 4)
+	if err != nil {
+		t.Fatalf("Error building priority matches: %s", err)
+	}
+
+	expected := []string{"PRIORITY=2", "PRIORITY=3", "PRIORITY=4"}
+	if len(matches) != len(expected) {
+		t.Fatalf("Expected %d matches, got %d", len(expected), len(matches))
+	}
+	for i, m := range matches {
+		if m.String() != expected[i] {
+			t.Errorf("Expected match %q, got %q", expected[i], m.String())
+		}
+	}
+
+	for _, r := range [][2]int{{-1, 3}, {0, 8}, {5, 2}} {
+		if _, err := MatchPriorityRange(r[0], r[1]); err == nil {
+			t.Errorf("Expected an error for priority range %d-%d", r[0], r[1])
+		}
+	}
+}
+
+func TestMatchExpressionString(t *testing.T) {
+	a := Match{Field: "A", Value: "a"}
+	b := Match{Field: "B", Value: "b"}
+	c := Match{Field: "C", Value: "c"}
+	d := Match{Field: "D", Value: "d"}
+
+	var e MatchExpression
+	if s := e.String(); s != "" {
+		t.Errorf("Expected an empty expression, got %q", s)
+	}
+
+	e.Or(a).Or(b, c).And().And().Or(d)
+	if s, expected := e.String(), "(A=a OR B=b AND C=c) AND (D=d)"; s != expected {
+		t.Errorf("Expected %q, got %q", expected, s)
+	}
+}
+
+func TestMatchExpressionDuplicateField(t *testing.T) {
+	a := Match{Field: "A", Value: "a"}
+	a2 := Match{Field: "A", Value: "a2"}
+	b := Match{Field: "B", Value: "b"}
+
+	var valid MatchExpression
+	valid.Or(a, b).Or(a2).And().Or(a).Or(a2)
+	if err := valid.validate(); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+
+	var invalid MatchExpression
+	invalid.Or(b).And().Or(a, b, a2)
+	if err := invalid.validate(); err == nil {
+		t.Error("Expected an error for two matches on A in the same alternative")
+	}
+	if err := (&Journal{}).AddMatchExpression(&invalid); err == nil {
+		t.Error("Expected AddMatchExpression to reject the expression")
+	}
+}
+
+func TestCheckJournalDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdjournal")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := checkJournalDir(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+
+	if err := checkJournalDir(dir); err == nil {
+		t.Error("Expected an error for a directory without journal files")
+	}
+
+	machineDir := filepath.Join(dir, "0123456789abcdef0123456789abcdef")
+	if err := os.Mkdir(machineDir, 0755); err != nil {
+		t.Fatalf("Error creating machine directory: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(machineDir, "system.journal"), nil, 0644); err != nil {
+		t.Fatalf("Error creating journal file: %s", err)
+	}
+
+	if err := checkJournalDir(dir); err != nil {
+		t.Errorf("Unexpected error for a directory with journal files: %s", err)
+	}
+}
+
+func TestBuildExportMessage(t *testing.T) {
+	r := &JournalReader{}
+	msg, err := r.buildExportMessage(JournalEntry{
+		"__CURSOR":              "s=1;i=2",
+		"__REALTIME_TIMESTAMP":  uint64(1000),
+		"__MONOTONIC_TIMESTAMP": uint64(500),
+		"__BOOT_ID":             "0123",
+		"MESSAGE":               "line one\nline two",
+		"PRIORITY":              "6",
+		"BINARY":                []byte{0x00, 0xff},
+	})
+	if err != nil {
+		t.Fatalf("Error building export message: %s", err)
+	}
+
+	expected := "__CURSOR=s=1;i=2\n" +
+		"__REALTIME_TIMESTAMP=1000\n" +
+		"__MONOTONIC_TIMESTAMP=500\n" +
+		"BINARY\n\x02\x00\x00\x00\x00\x00\x00\x00\x00\xff\n" +
+		"MESSAGE\n\x11\x00\x00\x00\x00\x00\x00\x00line one\nline two\n" +
+		"PRIORITY=6\n" +
+		"\n"
+	if msg != expected {
+		t.Fatalf("Unexpected export message:\n%q\nexpected:\n%q", msg, expected)
+	}
+}
+
+func TestBuildJsonMessageBinary(t *testing.T) {
+	r := &JournalReader{}
+	entry := make(JournalEntry)
+	addToMap(entry, "MESSAGE", []byte("hello"))
+	addToMap(entry, "COREDUMP", []byte{'a', 0x00, 0xff})
+	addToMap(entry, "NUL", []byte{'a', 0x00, 'b'})
+
+	msg, err := r.buildJsonMessage(entry)
+	if err != nil {
+		t.Fatalf("Error building JSON message: %s", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(msg), &decoded); err != nil {
+		t.Fatalf("Invalid JSON message %q: %s", msg, err)
+	}
+
+	if decoded["MESSAGE"] != "hello" {
+		t.Errorf("Unexpected MESSAGE value: %v", decoded["MESSAGE"])
+	}
+	if decoded["NUL"] != "a\x00b" {
+		t.Errorf("Unexpected NUL value: %q", decoded["NUL"])
+	}
+
+	values, ok := decoded["COREDUMP"].([]interface{})
+	if !ok {
+		t.Fatalf("Expected COREDUMP to be an array, got %T", decoded["COREDUMP"])
+	}
+	expected := []float64{'a', 0x00, 0xff}
+	if len(values) != len(expected) {
+		t.Fatalf("Expected %d COREDUMP bytes, got %d", len(expected), len(values))
+	}
+	for i, v := range values {
+		if v != expected[i] {
+			t.Errorf("Unexpected COREDUMP byte %d: %v", i, v)
+		}
+	}
+}
+
+func TestJournalReaderReadSmallBuffer(t *testing.T) {
+	expected := strings.Repeat("0123456789", 100) + "\n"
+	r := &JournalReader{msg: []byte(expected)}
+
+	var got []byte
+	b := make([]byte, 16)
+	for len(got) < len(expected) {
+		c, err := r.Read(b)
+		if err != nil {
+			t.Fatalf("Error reading message: %s", err)
+		}
+		if c > len(b) {
+			t.Fatalf("Read returned %d bytes for a %d byte buffer", c, len(b))
+		}
+		got = append(got, b[:c]...)
+	}
+
+	if string(got) != expected {
+		t.Fatalf("Reassembled message differs:\n%q\nexpected:\n%q", got, expected)
+	}
+}
+
+func TestJournalFollowNoGoroutineLeak(t *testing.T) {
+	r, err := NewJournalReader(JournalReaderConfig{
+		Matches: []Match{
+			{
+				Field: SD_JOURNAL_FIELD_SYSTEMD_UNIT,
+				Value: "go-systemd-nonexistent.service",
+			},
+		},
+		PollInterval: time.Duration(10) * time.Millisecond,
+	})
+
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+
+	defer r.Close()
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(5)*time.Millisecond)
+		if err = r.Follow(ctx, ioutil.Discard); err != ErrExpired {
+			t.Fatalf("Error during follow: %s", err)
+		}
+		cancel()
+	}
+
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("Goroutines leaked by Follow: %d before, %d after", before, after)
+	}
+}
+
+func TestJournalReaderTailFollow(t *testing.T) {
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	send := func(i int) {
+		vars := map[string]string{"GO_SYSTEMD_TEST": id}
+		if err := journal.Send(fmt.Sprintf("tail follow %d", i), journal.PriInfo, vars); err != nil {
+			t.Fatalf("Error writing to journal: %s", err)
+		}
+	}
+
+	for i := 1; i <= 3; i++ {
+		send(i)
+	}
+	time.Sleep(time.Duration(500) * time.Millisecond)
+
+	r, err := NewJournalReader(JournalReaderConfig{
+		NumFromTail: 2,
+		Follow:      true,
+		Matches: []Match{
+			{
+				Field: "GO_SYSTEMD_TEST",
+				Value: id,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+	defer r.Close()
+
+	for i := 4; i <= 5; i++ {
+		send(i)
+	}
+
+	for i := 2; i <= 5; i++ {
+		entry, err := r.ReadEntry()
+		if err != nil {
+			t.Fatalf("Error reading entry: %s", err)
+		}
+		if expected := fmt.Sprintf("tail follow %d", i); entry["MESSAGE"] != expected {
+			t.Fatalf("Expected %q, got %q", expected, entry["MESSAGE"])
+		}
+	}
+}
+
+func TestJournalSendBinary(t *testing.T) {
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	value := []byte("first line\nsecond line\x00\xff")
+	if err := journal.SendBinary("binary field", journal.PriInfo, map[string][]byte{
+		"GO_SYSTEMD_TEST": []byte(id),
+		"PAYLOAD":         value,
+	}); err != nil {
+		t.Fatalf("Error writing to journal: %s", err)
+	}
+	time.Sleep(time.Duration(500) * time.Millisecond)
+
+	r, err := NewJournalReader(JournalReaderConfig{
+		SeekHead: true,
+		Matches: []Match{
+			{
+				Field: "GO_SYSTEMD_TEST",
+				Value: id,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+	defer r.Close()
+
+	entry, err := r.ReadEntry()
+	if err != nil {
+		t.Fatalf("Error reading entry: %s", err)
+	}
+	if payload, ok := entry["PAYLOAD"].([]byte); !ok || !bytes.Equal(payload, value) {
+		t.Fatalf("Expected PAYLOAD %q, got %q", value, entry["PAYLOAD"])
+	}
+}
+
+func TestJournalGetDataAllCatalogEntry(t *testing.T) {
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	// MESSAGE_ID of systemd's "unit started" catalog entry
+	if err := journal.Send("catalog entry", journal.PriInfo, map[string]string{
+		"GO_SYSTEMD_TEST": id,
+		"MESSAGE_ID":      "39f53479d3a045ac8e11786248231fbf",
+	}); err != nil {
+		t.Fatalf("Error writing to journal: %s", err)
+	}
+	time.Sleep(time.Duration(500) * time.Millisecond)
+
+	j, err := NewJournal()
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+	defer j.Close()
+
+	if err := j.AddMatch("GO_SYSTEMD_TEST=" + id); err != nil {
+		t.Fatalf("Error adding match: %s", err)
+	}
+	if c, err := j.Next(); err != nil || c == 0 {
+		t.Fatalf("Error moving to the entry: %v", err)
+	}
+
+	entry, err := j.GetDataAll()
+	if err != nil {
+		t.Fatalf("Error getting entry fields: %s", err)
+	}
+
+	catalog, err := j.GetCatalog()
+	switch {
+	case err == ErrNoCatalogEntry:
+		if _, ok := entry["CATALOG_ENTRY"]; ok {
+			t.Fatalf("Expected no CATALOG_ENTRY, got %q", entry["CATALOG_ENTRY"])
+		}
+	case err != nil:
+		t.Fatalf("Error getting catalog: %s", err)
+	case entry["CATALOG_ENTRY"] != catalog:
+		t.Fatalf("Expected CATALOG_ENTRY %q, got %q", catalog, entry["CATALOG_ENTRY"])
+	}
+}
+
+func TestJournalReaderCatalog(t *testing.T) {
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := journal.Send("catalog entry", journal.PriInfo, map[string]string{
+		"GO_SYSTEMD_TEST": id,
+		"MESSAGE_ID":      "39f53479d3a045ac8e11786248231fbf",
+	}); err != nil {
+		t.Fatalf("Error writing to journal: %s", err)
+	}
+	time.Sleep(time.Duration(500) * time.Millisecond)
+
+	matches := []Match{
+		{
+			Field: "GO_SYSTEMD_TEST",
+			Value: id,
+		},
+	}
+
+	for _, withCatalog := range []bool{false, true} {
+		r, err := NewJournalReader(JournalReaderConfig{SeekHead: true, Matches: matches, WithCatalog: withCatalog})
+		if err != nil {
+			t.Fatalf("Error opening journal: %s", err)
+		}
+
+		entry, err := r.ReadEntry()
+		if err != nil {
+			r.Close()
+			t.Fatalf("Error reading entry: %s", err)
+		}
+		catalog, err := r.Catalog()
+		r.Close()
+		if err != nil {
+			t.Fatalf("Error getting catalog: %s", err)
+		}
+
+		// CATALOG_ENTRY is always there, CATALOG only with WithCatalog
+		if catalog == "" {
+			if _, ok := entry["CATALOG_ENTRY"]; ok {
+				t.Errorf("Expected no CATALOG_ENTRY, got %q", entry["CATALOG_ENTRY"])
+			}
+		} else if entry["CATALOG_ENTRY"] != catalog {
+			t.Errorf("Expected CATALOG_ENTRY %q, got %q", catalog, entry["CATALOG_ENTRY"])
+		}
+		if _, ok := entry["CATALOG"]; ok != (withCatalog && catalog != "") {
+			t.Errorf("WithCatalog %t: unexpected CATALOG %q", withCatalog, entry["CATALOG"])
+		}
+	}
+}
+
+func TestValidID128(t *testing.T) {
+	for id, valid := range map[string]bool{
+		"0123456789abcdef0123456789ABCDEF":  true,
+		"0123456789abcdef0123456789abcde":   false,
+		"0123456789abcdef0123456789abcdef0": false,
+		"0123456789abcdef0123456789abcdeg":  false,
+		"":                                  false,
+	} {
+		if validID128(id) != valid {
+			t.Errorf("Expected validID128(%q) to be %t", id, valid)
+		}
+	}
+}
+
+func TestMatchConstructors(t *testing.T) {
+	if m, err := MatchBootID("0123456789abcdef0123456789abcdef"); err != nil || m.String() != "_BOOT_ID=0123456789abcdef0123456789abcdef" {
+		t.Errorf("Unexpected boot ID match %q: %v", m.String(), err)
+	}
+	if _, err := MatchBootID("not-a-boot-id"); err == nil {
+		t.Error("Expected an error for an invalid boot ID")
+	}
+
+	if m, err := MatchTransport("stdout"); err != nil || m.String() != "_TRANSPORT=stdout" {
+		t.Errorf("Unexpected transport match %q: %v", m.String(), err)
+	}
+	if _, err := MatchTransport("carrier-pigeon"); err == nil {
+		t.Error("Expected an error for an unknown transport")
+	}
+
+	if m, err := MatchSystemdUnit("sshd.service"); err != nil || m.String() != "_SYSTEMD_UNIT=sshd.service" {
+		t.Errorf("Unexpected unit match %q: %v", m.String(), err)
+	}
+	if _, err := MatchSystemdUnit("sshd"); err == nil {
+		t.Error("Expected an error for a unit name without a suffix")
+	}
+
+	if m, err := MatchPriority(3); err != nil || m.String() != "PRIORITY=3" {
+		t.Errorf("Unexpected priority match %q: %v", m.String(), err)
+	}
+	if _, err := MatchPriority(8); err == nil {
+		t.Error("Expected an error for an out of range priority")
+	}
+}
+
+func TestParseMatch(t *testing.T) {
+	for _, s := range []string{"PRIORITY=3", "MESSAGE=a=b", "CODE_FILE="} {
+		m, err := ParseMatch(s)
+		if err != nil {
+			t.Errorf("Unexpected error parsing %q: %s", s, err)
+			continue
+		}
+		if m.String() != s {
+			t.Errorf("Expected %q to round-trip, got %q", s, m.String())
+		}
+	}
+
+	if m, _ := ParseMatch("MESSAGE=a=b"); m.Field != "MESSAGE" || m.Value != "a=b" {
+		t.Errorf("Unexpected match %+v", m)
+	}
+
+	for _, s := range []string{"", "PRIORITY", "=3", "priority=3", "MY-FIELD=1"} {
+		if _, err := ParseMatch(s); err == nil {
+			t.Errorf("Expected an error parsing %q", s)
+		}
+	}
+}
+
+func TestValidFieldName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"MESSAGE":       true,
+		"_SYSTEMD_UNIT": true,
+		"CODE_LINE2":    true,
+		"":              false,
+		"message":       false,
+		"2FAST":         false,
+		"MY-FIELD":      false,
+	} {
+		if validFieldName(name) != valid {
+			t.Errorf("Expected validFieldName(%q) to be %t", name, valid)
+		}
+	}
+}
+
+func TestBuildJsonMessageStable(t *testing.T) {
+	r := &JournalReader{}
+	entry := JournalEntry{
+		"__CURSOR":             "s=1;i=2",
+		"__REALTIME_TIMESTAMP": uint64(1000),
+		"MESSAGE":              "hello",
+		"PRIORITY":             "6",
+		"_PID":                 "42",
+		"_SYSTEMD_UNIT":        "foo.service",
+		"COREDUMP":             []byte{0xff},
+	}
+
+	expected := `{"COREDUMP":[255],"MESSAGE":"hello","PRIORITY":"6","_PID":"42","_SYSTEMD_UNIT":"foo.service","__CURSOR":"s=1;i=2","__REALTIME_TIMESTAMP":1000}` + "\n"
+	for i := 0; i < 20; i++ {
+		msg, err := r.buildJsonMessage(entry)
+		if err != nil {
+			t.Fatalf("Error building JSON message: %s", err)
+		}
+		if msg != expected {
+			t.Fatalf("Unexpected JSON message:\n%s\nexpected:\n%s", msg, expected)
+		}
+	}
+}
+
+func TestJournalGetEntrySize(t *testing.T) {
+	j, err := NewJournal()
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+	defer j.Close()
+
+	if err := j.SeekTail(); err != nil {
+		t.Fatalf("Error seeking to tail: %s", err)
+	}
+	if _, err := j.Previous(); err != nil {
+		t.Fatalf("Error moving to the last entry: %s", err)
+	}
+
+	fields, size, err := j.GetEntrySize()
+	if err != nil {
+		t.Fatalf("Error getting entry size: %s", err)
+	}
+
+	bufs, err := j.GetDataAllBytes(nil)
+	if err != nil {
+		t.Fatalf("Error getting entry fields: %s", err)
+	}
+	var expected uint64
+	for _, b := range bufs {
+		expected += uint64(len(b))
+	}
+	if fields != len(bufs) || size != expected {
+		t.Fatalf("Expected %d fields of %d bytes, got %d fields of %d bytes", len(bufs), expected, fields, size)
+	}
+}
+
+func benchmarkJournal(b *testing.B) *Journal {
+	j, err := NewJournal()
+	if err != nil {
+		b.Fatalf("Error opening journal: %s", err)
+	}
+
+	if err := j.SeekTail(); err != nil {
+		b.Fatalf("Error seeking to tail of journal: %s", err)
+	}
+	if c, err := j.Previous(); err != nil || c == 0 {
+		b.Fatalf("Error moving to last journal entry: %v", err)
+	}
+
+	return j
+}
+
+func BenchmarkGetData(b *testing.B) {
+	j := benchmarkJournal(b)
+	defer j.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := j.GetData("MESSAGE"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetDataBytes(b *testing.B) {
+	j := benchmarkJournal(b)
+	defer j.Close()
+
+	var buf []byte
+	var err error
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if buf, err = j.GetDataBytes("MESSAGE", buf[:0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetDataAll(b *testing.B) {
+	j := benchmarkJournal(b)
+	defer j.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := j.GetDataAll(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkGetDataPerField reads the same fields as BenchmarkGetDataAll, but
+// with one GetData lookup per field, for comparison.
+func BenchmarkGetDataPerField(b *testing.B) {
+	j := benchmarkJournal(b)
+	defer j.Close()
+
+	entry, err := j.GetDataAll()
+	if err != nil {
+		b.Fatal(err)
+	}
+	var fields []string
+	for name := range entry {
+		if !strings.HasPrefix(name, "__") {
+			fields = append(fields, name)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, field := range fields {
+			if _, err := j.GetData(field); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkGetDataAllBytes(b *testing.B) {
+	j := benchmarkJournal(b)
+	defer j.Close()
+
+	var bufs [][]byte
+	var err error
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if bufs, err = j.GetDataAllBytes(bufs); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkReadEntry(b *testing.B, reuse bool) {
+	r, err := NewJournalReader(JournalReaderConfig{
+		SeekHead:     true,
+		ReuseEntries: reuse,
+	})
+	if err != nil {
+		b.Fatalf("Error opening journal: %s", err)
+	}
+	defer r.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		entry, err := r.ReadEntry()
+		if err == io.EOF {
+			if err := r.Journal.SeekHead(); err != nil {
+				b.Fatalf("Error seeking to head of journal: %s", err)
+			}
+			continue
+		}
+		if err != nil {
+			b.Fatalf("Error reading entry: %s", err)
+		}
+		r.ReleaseEntry(entry)
+	}
+}
+
+func BenchmarkReadEntry(b *testing.B) {
+	benchmarkReadEntry(b, false)
+}
+
+func BenchmarkReadEntryReuse(b *testing.B) {
+	benchmarkReadEntry(b, true)
+}
+
+func TestJournalConcurrentUsageClose(t *testing.T) {
+	j, err := NewJournal()
+
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k := 0; k < 100; k++ {
+				// Errors are expected once the journal is closed
+				j.GetUsage()
+			}
+		}()
+	}
+
+	time.Sleep(time.Millisecond)
+	if err := j.Close(); err != nil {
+		t.Fatalf("Error closing journal: %s", err)
+	}
+	wg.Wait()
+
+	if _, err := j.GetUsage(); err == nil {
+		t.Fatal("Expected an error getting usage of a closed journal")
+	}
+}
+
+func TestJournalSeekCursorAndNext(t *testing.T) {
+	j, err := NewJournal()
+
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+
+	defer j.Close()
+
+	// Pick an entry a few positions before the tail
+	if err := j.SeekTail(); err != nil {
+		t.Fatalf("Error seeking to tail of journal: %s", err)
+	}
+	if _, err := j.PreviousSkip(5); err != nil {
+		t.Fatalf("Error moving back from tail of journal: %s", err)
+	}
+	cursor, err := j.GetCursor()
+	if err != nil {
+		t.Fatalf("Error getting cursor: %s", err)
+	}
+
+	if err := j.SeekHead(); err != nil {
+		t.Fatalf("Error seeking to head of journal: %s", err)
+	}
+
+	found, err := j.SeekCursorAndNext(cursor)
+	if err != nil {
+		t.Fatalf("Error seeking to cursor: %s", err)
+	}
+	if !found {
+		t.Fatalf("Cursor %q not found", cursor)
+	}
+
+	if ok, err := j.TestCursor(cursor); err != nil || !ok {
+		t.Fatalf("Read pointer not on cursor %q: %v", cursor, err)
+	}
+}
+
+func TestNewJournalFromFilesMissing(t *testing.T) {
+	missing := "/nonexistent/go-systemd/system.journal"
+	_, err := NewJournalFromFiles(missing)
+
+	if err == nil {
+		t.Fatal("Expected an error opening a missing journal file")
+	}
+	if !strings.Contains(err.Error(), missing) {
+		t.Fatalf("Expected the error to name the missing file, got: %s", err)
+	}
+}
+
+func TestJournalFollowWritesExactBytes(t *testing.T) {
+	expected := `{"MESSAGE":"hello"}` + "\n"
+	r := &JournalReader{
+		config: JournalReaderConfig{MaxEntries: 1},
+		msg:    []byte(expected),
+	}
+
+	var buf bytes.Buffer
+	if err := r.Follow(context.Background(), &buf); err != nil {
+		t.Fatalf("Error during follow: %s", err)
+	}
+
+	if buf.String() != expected {
+		t.Fatalf("Unexpected output %q, expected %q", buf.String(), expected)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestJournalFollowWriteError(t *testing.T) {
+	r := &JournalReader{msg: []byte(`{"MESSAGE":"hello"}` + "\n")}
+
+	if err := r.Follow(context.Background(), failingWriter{}); err != io.ErrClosedPipe {
+		t.Fatalf("Expected the write error to be returned, got: %v", err)
+	}
+}
+
+func TestJournalEntryAccessors(t *testing.T) {
+	entry := JournalEntry{
+		"PRIORITY":             "3",
+		"_SYSTEMD_UNIT":        "foo.service",
+		"MESSAGE":              []byte("binary\x00message"),
+		"__REALTIME_TIMESTAMP": uint64(1420070400000001),
+	}
+
+	if p := entry.Priority(); p != 3 {
+		t.Errorf("Expected priority 3, got %d", p)
+	}
+	if u := entry.Unit(); u != "foo.service" {
+		t.Errorf("Expected unit foo.service, got %q", u)
+	}
+	if m := entry.Message(); m != "binary\x00message" {
+		t.Errorf("Unexpected message %q", m)
+	}
+	if ts := entry.Time(); !ts.Equal(time.Unix(1420070400, 1000)) {
+		t.Errorf("Unexpected time %v", ts)
+	}
+
+	for _, priority := range []interface{}{nil, "", " ", "high", "8", "-1"} {
+		e := JournalEntry{}
+		if priority != nil {
+			e["PRIORITY"] = priority
+		}
+		if p := e.Priority(); p != 6 {
+			t.Errorf("Expected default priority 6 for %q, got %d", priority, p)
+		}
+	}
+
+	empty := JournalEntry{}
+	if empty.Unit() != "" || empty.Message() != "" || !empty.Time().IsZero() {
+		t.Errorf("Expected zero values for an empty entry")
+	}
+
+	repeated := JournalEntry{"MESSAGE": []string{"first", "second"}}
+	if m := repeated.Message(); m != "first" {
+		t.Errorf("Expected the first of repeated values, got %q", m)
+	}
+}
+
+func TestJournalReaderCursorResume(t *testing.T) {
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	for i := 1; i <= 3; i++ {
+		vars := map[string]string{"GO_SYSTEMD_TEST": id}
+		if err := journal.Send(fmt.Sprintf("resume %d", i), journal.PriInfo, vars); err != nil {
+			t.Fatalf("Error writing to journal: %s", err)
+		}
+	}
+	time.Sleep(time.Duration(500) * time.Millisecond)
+
+	matches := []Match{
+		{
+			Field: "GO_SYSTEMD_TEST",
+			Value: id,
+		},
+	}
+
+	// read the first entry and save its cursor, as a restarting tailer would
+	r, err := NewJournalReader(JournalReaderConfig{SeekHead: true, Matches: matches})
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+	entry, err := r.ReadEntry()
+	if err != nil {
+		t.Fatalf("Error reading entry: %s", err)
+	}
+	if entry["MESSAGE"] != "resume 1" {
+		t.Fatalf("Expected %q, got %q", "resume 1", entry["MESSAGE"])
+	}
+	cursor, err := r.Cursor()
+	if err != nil {
+		t.Fatalf("Error getting cursor: %s", err)
+	}
+	r.Close()
+
+	// resuming must start strictly after the saved entry
+	r, err = NewJournalReader(JournalReaderConfig{Cursor: cursor, Matches: matches})
+	if err != nil {
+		t.Fatalf("Error opening journal at cursor: %s", err)
+	}
+	defer r.Close()
+
+	for i := 2; i <= 3; i++ {
+		entry, err := r.ReadEntry()
+		if err != nil {
+			t.Fatalf("Error reading entry: %s", err)
+		}
+		if expected := fmt.Sprintf("resume %d", i); entry["MESSAGE"] != expected {
+			t.Fatalf("Expected %q, got %q", expected, entry["MESSAGE"])
+		}
+	}
+	if _, err := r.ReadEntry(); err != io.EOF {
+		t.Fatalf("Expected io.EOF after the last entry, got %v", err)
+	}
+}
+
+func TestJournalGetSeqnum(t *testing.T) {
+	j, err := NewJournal()
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+	defer j.Close()
+
+	if err := j.SeekTail(); err != nil {
+		t.Fatalf("Error seeking to tail: %s", err)
+	}
+	if _, err := j.Previous(); err != nil {
+		t.Fatalf("Error moving to the last entry: %s", err)
+	}
+
+	seqnum, seqnumID, err := j.GetSeqnum()
+	if err == ErrSeqnumNotSupported {
+		t.Skip("libsystemd does not support sequence numbers")
+	}
+	if err != nil {
+		t.Fatalf("Error getting seqnum: %s", err)
+	}
+	if seqnum == 0 || !validID128(seqnumID) {
+		t.Fatalf("Unexpected seqnum %d with ID %q", seqnum, seqnumID)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	start := time.Unix(1420070400, 0)
+	l := newRateLimiter(2, start)
+
+	// A full bucket lets a burst of one second worth of entries through
+	for i := 0; i < 2; i++ {
+		if !l.allow(start) {
+			t.Fatalf("Expected entry %d of the burst to be allowed", i)
+		}
+	}
+	if l.allow(start) {
+		t.Fatalf("Expected entry over the burst to be limited")
+	}
+	if d := l.delay(start); d != 500*time.Millisecond {
+		t.Errorf("Expected a delay of 500ms, got %v", d)
+	}
+
+	later := start.Add(500 * time.Millisecond)
+	if d := l.delay(later); d != 0 {
+		t.Errorf("Expected no delay once refilled, got %v", d)
+	}
+	if !l.allow(later) {
+		t.Errorf("Expected entry to be allowed once refilled")
+	}
+
+	// Tokens do not accumulate past the burst
+	if !l.allow(later.Add(time.Hour)) || !l.allow(later.Add(time.Hour)) || l.allow(later.Add(time.Hour)) {
+		t.Errorf("Expected the bucket to be capped to the burst")
+	}
+
+	l.dropped = 3
+	m := l.marker(start)
+	if msg := m.Message(); msg != "rate limited, dropped 3 entries" {
+		t.Errorf("Unexpected marker message %q", msg)
+	}
+	if d := m.Field("DROPPED"); d != "3" {
+		t.Errorf("Unexpected DROPPED field %q", d)
+	}
+	if !m.Time().Equal(start) {
+		t.Errorf("Unexpected marker time %v", m.Time())
+	}
+	if l.dropped != 0 {
+		t.Errorf("Expected the dropped count to be reset")
+	}
+
+	// Slow rates still allow single entries
+	if slow := newRateLimiter(0.5, start); !slow.allow(start) || slow.allow(start) {
+		t.Errorf("Expected a burst of one entry below one entry per second")
+	}
+}
+
+func TestLimitPriority(t *testing.T) {
+	unit := Match{Field: SD_JOURNAL_FIELD_SYSTEMD_UNIT, Value: "foo.service"}
+	prio := func(p string) Match { return Match{Field: SD_JOURNAL_FIELD_PRIORITY, Value: p} }
+
+	tests := []struct {
+		matches []Match
+		max     int
+
+		expected []Match
+		err      bool
+	}{
+		// Without PRIORITY matches, the whole range is added
+		{nil, 2, []Match{prio("0"), prio("1"), prio("2")}, false},
+		{[]Match{unit}, 0, []Match{unit, prio("0")}, false},
+
+		// PRIORITY matches are intersected with the range
+		{[]Match{prio("3"), unit}, 4, []Match{prio("3"), unit}, false},
+		{[]Match{prio("1"), prio("6"), unit}, 4, []Match{prio("1"), unit}, false},
+		{[]Match{prio("x"), prio("2")}, 4, []Match{prio("2")}, false},
+
+		// Nothing is left of the PRIORITY matches
+		{[]Match{prio("6"), unit}, 4, nil, true},
+
+		// Invalid MaxPriority
+		{nil, 8, nil, true},
+		{nil, -1, nil, true},
+	}
+
+	for i, tt := range tests {
+		limited, err := limitPriority(tt.matches, tt.max)
+		if tt.err {
+			if err == nil {
+				t.Errorf("case %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		} else if !reflect.DeepEqual(limited, tt.expected) {
+			t.Errorf("case %d: expected %v, got %v", i, tt.expected, limited)
+		}
+	}
+}
+
+func TestNewJournalReaderPriorityExcluded(t *testing.T) {
+	max := 3
+	_, err := NewJournalReader(JournalReaderConfig{
+		MaxPriority: &max,
+		Matches:     []Match{{Field: SD_JOURNAL_FIELD_PRIORITY, Value: "6"}},
+	})
+	if err == nil {
+		t.Fatal("Expected an error for PRIORITY matches above MaxPriority")
+	}
+}
+
+func TestNewJournalReaderNegativeRate(t *testing.T) {
+	if _, err := NewJournalReader(JournalReaderConfig{MaxEntriesPerSecond: -1}); err == nil {
+		t.Fatal("Expected an error for a negative MaxEntriesPerSecond")
+	}
+}
+
+func TestIndexBoots(t *testing.T) {
+	at := func(sec int64) time.Time { return time.Unix(sec, 0) }
+	boots := []Boot{
+		{BootID: "c", FirstRealtime: at(300), LastRealtime: at(400)},
+		{BootID: "a", FirstRealtime: at(100), LastRealtime: at(150)},
+		{BootID: "b", FirstRealtime: at(200), LastRealtime: at(250)},
+	}
+
+	indexBoots(boots)
+
+	for i, expected := range []struct {
+		id    string
+		index int
+	}{{"a", -2}, {"b", -1}, {"c", 0}} {
+		if boots[i].BootID != expected.id || boots[i].Index != expected.index {
+			t.Errorf("Expected boot %s at index %d in position %d, got %+v", expected.id, expected.index, i, boots[i])
+		}
+	}
+
+	for offset, id := range map[int]string{0: "c", -1: "b", -2: "a", 1: "a", 3: "c"} {
+		boot, err := findBoot(boots, offset)
+		if err != nil {
+			t.Errorf("Unexpected error for offset %d: %s", offset, err)
+			continue
+		}
+		if boot.BootID != id {
+			t.Errorf("Expected boot %s for offset %d, got %s", id, offset, boot.BootID)
+		}
+	}
+
+	for _, offset := range []int{-3, 4} {
+		if _, err := findBoot(boots, offset); err == nil {
+			t.Errorf("Expected an error for offset %d", offset)
+		}
+	}
+	if _, err := findBoot(nil, 0); err == nil {
+		t.Errorf("Expected an error for an empty journal")
+	}
+}
+
+func TestAddToMapRepeated(t *testing.T) {
+	entry := make(JournalEntry)
+	addToMap(entry, "TAG", []byte("a"))
+	addToMap(entry, "TAG", []byte("b"))
+	if v, ok := entry["TAG"].([]string); !ok || !reflect.DeepEqual(v, []string{"a", "b"}) {
+		t.Fatalf("Unexpected TAG value: %#v", entry["TAG"])
+	}
+
+	// A binary value turns the field into [][]byte rather than being mangled
+	addToMap(entry, "TAG", []byte{0xff})
+	expected := [][]byte{[]byte("a"), []byte("b"), {0xff}}
+	if v, ok := entry["TAG"].([][]byte); !ok || !reflect.DeepEqual(v, expected) {
+		t.Fatalf("Unexpected TAG value: %#v", entry["TAG"])
+	}
+
+	addToMap(entry, "MIXED", []byte("text"))
+	addToMap(entry, "MIXED", []byte{0xff})
+	expected = [][]byte{[]byte("text"), {0xff}}
+	if v, ok := entry["MIXED"].([][]byte); !ok || !reflect.DeepEqual(v, expected) {
+		t.Fatalf("Unexpected MIXED value: %#v", entry["MIXED"])
+	}
+
+	r := &JournalReader{}
+	msg, err := r.buildJsonMessage(entry)
+	if err != nil {
+		t.Fatalf("Error building JSON message: %s", err)
+	}
+	expectedJSON := `{"MIXED":["text",[255]],"TAG":["a","b",[255]]}` + "\n"
+	if msg != expectedJSON {
+		t.Errorf("Unexpected JSON message %q, expected %q", msg, expectedJSON)
+	}
+}
+
+func TestJournalSendBinary(t *testing.T) {
+	if !journal.Enabled() {
+		t.Skip("journald is not available")
+	}
+
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	value := []byte("first\nsecond\x00third\n")
+	vars := map[string][]byte{
+		"GO_SYSTEMD_TEST":    []byte(id),
+		"GO_SYSTEMD_PAYLOAD": value,
+	}
+	if err := journal.SendBinary("binary", journal.PriInfo, vars); err != nil {
+		t.Fatalf("Error writing to journal: %s", err)
+	}
+	time.Sleep(time.Duration(500) * time.Millisecond)
+
+	j, err := NewJournal()
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+	defer j.Close()
+
+	if err := j.AddMatch("GO_SYSTEMD_TEST=" + id); err != nil {
+		t.Fatalf("Error adding match: %s", err)
+	}
+	if err := j.SeekHead(); err != nil {
+		t.Fatalf("Error seeking to head: %s", err)
+	}
+	if n, err := j.Next(); err != nil || n == 0 {
+		t.Fatalf("Entry not found: %v", err)
+	}
+
+	data, err := j.GetDataBytes("GO_SYSTEMD_PAYLOAD", nil)
+	if err != nil {
+		t.Fatalf("Error reading field: %s", err)
+	}
+	if expected := append([]byte("GO_SYSTEMD_PAYLOAD="), value...); !bytes.Equal(data, expected) {
+		t.Errorf("Expected %q, got %q", expected, data)
+	}
+}
+
+func TestJournalDataThreshold(t *testing.T) {
+	j, err := NewJournal()
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+	defer j.Close()
+
+	for _, threshold := range []uint64{0, 1024} {
+		if err := j.SetDataThreshold(threshold); err != nil {
+			t.Fatalf("Error setting data threshold: %s", err)
+		}
+		got, err := j.GetDataThreshold()
+		if err != nil {
+			t.Fatalf("Error getting data threshold: %s", err)
+		}
+		if got != threshold {
+			t.Errorf("Expected data threshold %d, got %d", threshold, got)
+		}
+	}
+}
+
+func TestJournalReaderEntriesBetween(t *testing.T) {
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	start := time.Now()
+	for i := 1; i <= 3; i++ {
+		vars := map[string]string{"GO_SYSTEMD_TEST": id}
+		if err := journal.Send(fmt.Sprintf("between %d", i), journal.PriInfo, vars); err != nil {
+			t.Fatalf("Error writing to journal: %s", err)
+		}
+	}
+	time.Sleep(time.Duration(500) * time.Millisecond)
+	end := time.Now()
+
+	matches := []Match{
+		{
+			Field: "GO_SYSTEMD_TEST",
+			Value: id,
+		},
+	}
+
+	r, err := NewJournalReader(JournalReaderConfig{Matches: matches})
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+	defer r.Close()
+
+	entries, err := r.EntriesBetween(context.Background(), start, end, 0)
+	if err != nil {
+		t.Fatalf("Error reading entries: %s", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	for i, entry := range entries {
+		if expected := fmt.Sprintf("between %d", i+1); entry["MESSAGE"] != expected {
+			t.Errorf("Expected %q, got %q", expected, entry["MESSAGE"])
+		}
+	}
+
+	if entries, err := r.EntriesBetween(context.Background(), end, end.Add(time.Minute), 0); err != nil || len(entries) != 0 {
+		t.Errorf("Expected no entries after the range, got %d: %v", len(entries), err)
+	}
+	if entries, err := r.EntriesBetween(context.Background(), start, end, 2); err != nil || len(entries) != 2 {
+		t.Errorf("Expected 2 entries with a limit, got %d: %v", len(entries), err)
+	}
+	if _, err := r.EntriesBetween(context.Background(), end, start, 0); err == nil {
+		t.Errorf("Expected an error for an inverted range")
+	}
+}
+
+func TestJournalReaderFormatTime(t *testing.T) {
+	ts := time.Unix(1420070400, 123456000)
+
+	r := &JournalReader{}
+	if s := r.formatTime(ts); s != "2015-01-01T00:00:00.123456Z" {
+		t.Errorf("Unexpected default timestamp %q", s)
+	}
+
+	r.config.TimeFormat = "2006-01-02 15:04:05.000 -0700"
+	r.config.TimeLocation = time.FixedZone("test", 2*60*60)
+	if s := r.formatTime(ts); s != "2015-01-01 02:00:00.123 +0200" {
+		t.Errorf("Unexpected custom timestamp %q", s)
+	}
+}
+
+func TestJournalReaderDrain(t *testing.T) {
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	for i := 1; i <= 3; i++ {
+		vars := map[string]string{"GO_SYSTEMD_TEST": id}
+		if err := journal.Send(fmt.Sprintf("drain %d", i), journal.PriInfo, vars); err != nil {
+			t.Fatalf("Error writing to journal: %s", err)
+		}
+	}
+	time.Sleep(time.Duration(500) * time.Millisecond)
+
+	matches := []Match{
+		{
+			Field: "GO_SYSTEMD_TEST",
+			Value: id,
+		},
+	}
+
+	// Follow mode must not make Drain wait for new entries, and MaxEntries,
+	// which only limits following, must not limit it
+	r, err := NewJournalReader(JournalReaderConfig{SeekHead: true, Matches: matches, Follow: true, MaxEntries: 1})
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+	defer r.Close()
+
+	for _, expected := range []int{2, 1, 0} {
+		entries, err := r.Drain(context.Background(), 2)
+		if err != nil {
+			t.Fatalf("Error draining journal: %s", err)
+		}
+		if len(entries) != expected {
+			t.Fatalf("Expected %d entries, got %d", expected, len(entries))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.Drain(ctx, 0); err != ErrExpired {
+		t.Errorf("Expected ErrExpired once ctx is done, got %v", err)
+	}
+}
+
+func TestLibsystemdVersion(t *testing.T) {
+	tests := []struct {
+		symbols []string
+		version int
+	}{
+		{[]string{"sd_journal_enumerate_fields"}, 229},
+		{[]string{"sd_journal_enumerate_fields", "sd_journal_open_directory_fd", "sd_journal_open_namespace"}, 245},
+		{[]string{"sd_journal_enumerate_fields", "sd_journal_get_seqnum"}, 254},
+	}
+
+	for i, tt := range tests {
+		version, err := libsystemdVersion(func(symbol string) bool {
+			for _, s := range tt.symbols {
+				if s == symbol {
+					return true
+				}
+			}
+			return false
+		})
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %s", i, err)
+			continue
+		}
+		if version != tt.version {
+			t.Errorf("case %d: expected version %d, got %d", i, tt.version, version)
+		}
+	}
+
+	if _, err := libsystemdVersion(func(string) bool { return false }); err != ErrUnknownVersion {
+		t.Errorf("Expected ErrUnknownVersion, got %v", err)
+	}
+
+	// The linked libsystemd provides at least the functions used here
+	if !hasSymbol("sd_journal_open") {
+		t.Errorf("Expected sd_journal_open to be found")
+	}
+	if hasSymbol("sd_journal_no_such_function") {
+		t.Errorf("Expected an unknown function not to be found")
+	}
+}
+
+func TestJournalCloseWakesWaitContext(t *testing.T) {
+	j, err := NewJournal()
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+
+	waited := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := j.WaitContext(context.Background()); err != nil {
+				waited <- err
+				return
+			}
+		}
+	}()
+
+	// Let the waiter park in poll(2) before closing the journal under it
+	time.Sleep(100 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		j.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked by a waiting WaitContext")
+	}
+	select {
+	case err := <-waited:
+		if err != ErrJournalClosed {
+			t.Errorf("Expected ErrJournalClosed, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitContext not woken up by Close")
+	}
+}
+
+func TestJournalCloseWakesWait(t *testing.T) {
+	j, err := NewJournal()
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+
+	waited := make(chan int, 1)
+	go func() {
+		for {
+			if r := j.Wait(IndefiniteWait); r < 0 {
+				waited <- r
+				return
+			}
+		}
+	}()
+
+	// Let the waiter park in poll(2) before closing the journal under it
+	time.Sleep(100 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		j.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked by a waiting Wait")
+	}
+	select {
+	case r := <-waited:
+		if r != -int(syscall.EINVAL) {
+			t.Errorf("Expected -EINVAL, got %d", r)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait not woken up by Close")
+	}
+}
+
+func TestJournalReaderCloseWhileFollowing(t *testing.T) {
+	// Match nothing, so that the reader waits at the tail
+	matches := []Match{
+		{
+			Field: "GO_SYSTEMD_TEST",
+			Value: strconv.FormatInt(time.Now().UnixNano(), 10),
+		},
+	}
+
+	r, err := NewJournalReader(JournalReaderConfig{Matches: matches, Follow: true})
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		for {
+			_, err := r.ReadEntryContext(context.Background())
+			if err == io.EOF {
+				done <- nil
+				return
+			}
+			if err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	r.Close()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected reading to end with io.EOF, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reading a followed reader not stopped by Close")
+	}
+}
+
+func TestJournalReaderCloseWaitsForOnIdle(t *testing.T) {
+	// Match nothing, so that the reader keeps idling at the tail
+	matches := []Match{
+		{
+			Field: "GO_SYSTEMD_TEST",
+			Value: strconv.FormatInt(time.Now().UnixNano(), 10),
+		},
+	}
+
+	idling := make(chan struct{}, 1)
+	release := make(chan struct{})
+	r, err := NewJournalReader(JournalReaderConfig{
+		Matches:      matches,
+		PollInterval: 10 * time.Millisecond,
+		OnIdle: func() {
+			select {
+			case idling <- struct{}{}:
+			default:
+			}
+			<-release
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	followed := make(chan error, 1)
+	go func() {
+		followed <- r.FollowJournal(ctx, make(chan JournalEntry))
+	}()
+
+	select {
+	case <-idling:
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnIdle not called")
+	}
+	cancel()
+	<-followed
+
+	closed := make(chan struct{})
+	go func() {
+		r.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("Close returned while OnIdle was running")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return once OnIdle did")
+	}
+}
+
+func TestJournalReaderOnIdleSkippedWhileRunning(t *testing.T) {
+	// Match nothing, so that the reader keeps idling at the tail
+	matches := []Match{
+		{
+			Field: "GO_SYSTEMD_TEST",
+			Value: strconv.FormatInt(time.Now().UnixNano(), 10),
+		},
+	}
+
+	var mu sync.Mutex
+	calls := 0
+	release := make(chan struct{})
+	r, err := NewJournalReader(JournalReaderConfig{
+		Matches:      matches,
+		PollInterval: 10 * time.Millisecond,
+		OnIdle: func() {
+			mu.Lock()
+			calls++
+			n := calls
+			mu.Unlock()
+			if n == 1 {
+				<-release
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Error opening journal: %s", err)
+	}
+	defer r.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	followed := make(chan error, 1)
+	go func() {
+		followed <- r.FollowJournal(ctx, make(chan JournalEntry))
+	}()
+
+	// Many idle timeouts go by while the first call blocks
+	time.Sleep(200 * time.Millisecond)
+	mu.Lock()
+	if calls != 1 {
+		t.Errorf("Expected a single OnIdle call while it blocks, got %d", calls)
+	}
+	mu.Unlock()
+
+	// Calls resume once it returns
+	close(release)
+	deadline := time.After(5 * time.Second)
+	for {
+		mu.Lock()
+		n := calls
+		mu.Unlock()
+		if n > 1 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("OnIdle not called again once the first call returned")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	cancel()
+	<-followed
+}
@@ -16,61 +16,390 @@
 package sdjournal
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"golang.org/x/net/context"
 )
 
 var (
-	ErrExpired = errors.New("Timeout expired")
+	ErrExpired        = errors.New("Timeout expired")
+	ErrCursorNotFound = errors.New("Cursor not found in journal")
+	ErrWriterClosed   = errors.New("Writer channel closed")
+)
+
+// OutputFormat selects how JournalReader.Read and Follow serialize entries.
+type OutputFormat int
+
+const (
+	FormatJSON      OutputFormat = iota // one JSON object per line
+	FormatExport                        // the journal export format, as consumed by systemd-journal-remote
+	FormatShortText                     // entry timestamp and MESSAGE field
+)
+
+// Logger receives the diagnostics of a JournalReader. It is implemented by
+// *log.Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// TimestampMode selects the timestamps printed with FormatShortText.
+type TimestampMode int
+
+const (
+	TimestampRealtime  TimestampMode = iota // wallclock time of the entry
+	TimestampMonotonic                      // monotonic time of the entry and its boot ID
+	TimestampBoth                           // both of the above
 )
 
 // JournalReaderConfig represents options to drive the behavior of a JournalReader.
 type JournalReaderConfig struct {
-	// The Since and NumFromTail options are mutually exclusive and determine
-	// where the reading begins within the journal.
+	// Flags selecting the journal files to read, as passed to
+	// NewJournalWithFlags, e.g. 0 for all of them. If nil,
+	// SD_JOURNAL_LOCAL_ONLY is used, as with NewJournal. Ignored when reading
+	// from Namespace, Path or Files.
+	OpenFlags *int
+
+	// Read the journal of the given namespace rather than the default one.
+	Namespace string
+
+	// Read the journal files found in the given directory, e.g. a copy of
+	// /var/log/journal, rather than the local journal. Path and Namespace
+	// are mutually exclusive.
+	Path string
+
+	// Read the given journal files as a single stream rather than the local
+	// journal. Files cannot be combined with Path or Namespace.
+	Files []string
+
+	// The Since, NumFromTail and SeekHead options are mutually exclusive and
+	// determine where the reading begins within the journal.
 	Since       time.Duration // start relative to a Duration from now
 	NumFromTail uint64        // start relative to the tail
+	SeekHead    bool          // start at the oldest available entry
+
+	// Resume reading after the entry identified by Cursor. Cursor cannot be
+	// combined with the other start options. The entry the cursor points to
+	// is verified with TestCursor and skipped, so that a reader resuming
+	// from the cursor of the last entry it handled, including in Follow
+	// mode, never returns that entry twice. If the exact entry can no
+	// longer be found, NewJournalReader returns ErrCursorNotFound.
+	Cursor string
+
+	// Start at the entry logged MonotonicUsec microseconds after the boot
+	// identified by BootID, a 32 character hexadecimal ID as found in the
+	// _BOOT_ID field. Setting BootID enables this option, which cannot be
+	// combined with the other start options.
+	BootID        string
+	MonotonicUsec uint64
 
 	// Show only journal entries whose fields match the supplied values. If
 	// the array is empty, entries will not be filtered.
 	Matches []Match
+
+	// Show only journal entries matching at least one of the supplied
+	// groups. Matches within a group are combined as with Matches, while
+	// the groups themselves are OR'ed together. If Matches is also set, an
+	// entry must satisfy both.
+	MatchGroups [][]Match
+
+	// Show only journal entries logged during the boot at BootOffset, as
+	// listed by ListBoots, like journalctl -b: 0 for the most recent boot in
+	// the journal, which is the current one for the local journal, -1 for
+	// the previous one, and so on. Positive offsets count from the oldest
+	// boot, 1 being the oldest. If nil, entries will not be filtered by boot.
+	BootOffset *int
+
+	// Show only journal entries with a PRIORITY of at most MaxPriority,
+	// e.g. 4 for warnings and above. If nil, entries will not be filtered by
+	// priority. PRIORITY values in Matches are narrowed down to those at
+	// most MaxPriority rather than widened to all of them; none being left
+	// is an error.
+	MaxPriority *int
+
+	// Truncate field values larger than DataThreshold bytes. The default
+	// of 0 disables truncation entirely, at the cost of holding every
+	// field, however large, in memory.
+	DataThreshold uint64
+
+	// Make Read, ReadEntry and ReadEntryFull wait for new entries at the
+	// tail of the journal instead of returning io.EOF, until the reader is
+	// closed. Combined with NumFromTail, this behaves like journalctl -n N
+	// -f: reading carries on from the last of the tail entries with the same
+	// read pointer, so that no entry is missed or repeated.
+	Follow bool
+
+	// Walk the journal backwards, newest entries first. Unless another
+	// start option is given, reading begins at the tail. Combined with
+	// NumFromTail, only that many of the most recent entries are returned
+	// before io.EOF.
+	Reverse bool
+
+	// Show only journal entries for which FilterFunc returns true. It is
+	// called with all the fields of each entry matched by the journal, so it
+	// can express filters that matches cannot, e.g. on MESSAGE contents.
+	FilterFunc func(JournalEntry) bool
+
+	// Attach the message catalog text explaining each entry, if any, under
+	// the CATALOG key as well, like journalctl -x does. Entries always carry
+	// it under CATALOG_ENTRY, as returned by Journal.GetDataAll.
+	WithCatalog bool
+
+	// The serialization used by Read and Follow. Defaults to FormatJSON.
+	OutputFormat OutputFormat
+
+	// The timestamps printed with FormatShortText. Defaults to
+	// TimestampRealtime.
+	TimestampMode TimestampMode
+
+	// The layout, as understood by time.Time.Format, of the realtime
+	// timestamps printed with FormatShortText, and the location they are
+	// shown in. Default to time.RFC3339Nano and UTC.
+	TimeFormat   string
+	TimeLocation *time.Location
+
+	// Stop following once MaxEntries entries have been written. When zero,
+	// the follow loops run until their context is done.
+	MaxEntries uint64
+
+	// Called by the follow loops each time they waited for new entries
+	// without any showing up, e.g. to emit keepalives. It runs on its own
+	// goroutine so as to not hold up following, and is not called anymore
+	// once the reader is closed. While a call is still running, e.g. blocked
+	// on a keepalive, the following idle timeouts are skipped rather than
+	// starting more calls. Close waits for the call in progress, so OnIdle
+	// must not close the reader itself.
+	OnIdle func()
+
+	// Reuse the maps holding entries returned by ReadEntry or pushed by
+	// FollowJournal, to reduce allocations when reading many entries. The
+	// caller owns each entry until passing it to ReleaseEntry, after which it
+	// must not be used anymore, as it will be overwritten. Entries which are
+	// not released are simply garbage collected.
+	ReuseEntries bool
+
+	// Called by the follow loops with the journal event whenever journal
+	// files were added or removed, e.g. on rotation, so that the caller can
+	// react, such as by checking that a saved cursor is still valid.
+	// Following resumes once it returns.
+	OnInvalidate func(event int)
+
+	// Where the follow loops report unexpected conditions, such as unknown
+	// journal events. When nil, they are discarded.
+	Logger Logger
+
+	// How long the follow loops wait for new journal events once the tail
+	// has been reached. When zero, Follow waits 1s and FollowJournal 100ms.
+	PollInterval time.Duration
+
+	// Limit the follow loops to MaxEntriesPerSecond entries per second on
+	// average, allowing bursts of up to one second worth of entries. By
+	// default entries over the limit are delayed, not lost: the loops simply
+	// read the journal more slowly, and catch up once the rate drops. When
+	// zero, entries are not rate limited.
+	MaxEntriesPerSecond float64
+
+	// Drop the entries over MaxEntriesPerSecond rather than delaying them.
+	// Before the next entry let through, the follow loops then emit a
+	// synthetic entry whose MESSAGE reads "rate limited, dropped N entries"
+	// and whose DROPPED field holds N. Such markers do not count towards
+	// MaxEntries.
+	DropRateLimited bool
+}
+
+// JournalEntryFull is a journal entry along with the timestamps and cursor
+// locating it in the journal.
+type JournalEntryFull struct {
+	Fields        JournalEntry
+	Cursor        string
+	RealtimeUsec  uint64
+	MonotonicUsec uint64
+	BootID        string // boot MonotonicUsec is relative to
+	Seqnum        uint64 // zero if libsystemd does not support seqnums
+	SeqnumID      string // sequence Seqnum belongs to
 }
 
 // JournalReader is an io.ReadCloser which provides a simple interface for iterating through the
 // systemd journal.
 type JournalReader struct {
 	Journal *Journal
+	config  JournalReaderConfig
+	count   uint64             // entries returned so far
+	msg     []byte             // unread part of the message being returned by Read
+	tail    uint64             // entries available out of NumFromTail
+	entries sync.Pool          // maps reused for entries when ReuseEntries is set
+	ctx     context.Context    // done once the reader is closed
+	cancel  context.CancelFunc // closes ctx
+	limiter *rateLimiter       // set when MaxEntriesPerSecond is
+	pending JournalEntry       // entry held back behind a rate limiting marker
+	idleMu  sync.Mutex         // orders starting OnIdle calls with Close, guards idling
+	idling  bool               // an OnIdle call is in progress
+	idlers  sync.WaitGroup     // OnIdle call in progress, for Close to wait for
 }
 
 // NewJournalReader creates a new JournalReader with configuration options that are similar to the
 // systemd journalctl tool's iteration and filtering features.
-func NewJournalReader(config JournalReaderConfig) (*JournalReader, error) {
-	r := &JournalReader{}
+func NewJournalReader(config JournalReaderConfig) (_ *JournalReader, err error) {
+	if config.SeekHead && (config.Since != 0 || config.NumFromTail != 0) {
+		return nil, errors.New("SeekHead cannot be combined with Since or NumFromTail")
+	}
+	if config.Cursor != "" && (config.SeekHead || config.Since != 0 || config.NumFromTail != 0) {
+		return nil, errors.New("Cursor cannot be combined with SeekHead, Since or NumFromTail")
+	}
+	if config.BootID != "" {
+		if config.Cursor != "" || config.SeekHead || config.Since != 0 || config.NumFromTail != 0 {
+			return nil, errors.New("BootID cannot be combined with Cursor, SeekHead, Since or NumFromTail")
+		}
+		if !validID128(config.BootID) {
+			return nil, fmt.Errorf("invalid boot ID %q: must be 32 hexadecimal characters", config.BootID)
+		}
+	}
+	if config.Namespace != "" && !HasNamespaces() {
+		return nil, errors.New("Namespace requires systemd 245 or newer, but the libsystemd in use is older")
+	}
+	if config.MaxEntriesPerSecond < 0 {
+		return nil, errors.New("MaxEntriesPerSecond cannot be negative")
+	}
+
+	// Copy Matches, which BootOffset adds to
+	matches := append([]Match(nil), config.Matches...)
+	if config.MaxPriority != nil {
+		if matches, err = limitPriority(matches, *config.MaxPriority); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(config.Files) > 0 && (config.Path != "" || config.Namespace != "") {
+		return nil, errors.New("Files cannot be combined with Path or Namespace")
+	}
+	if config.Path != "" {
+		if config.Namespace != "" {
+			return nil, errors.New("Path cannot be combined with Namespace")
+		}
+		if err := checkJournalDir(config.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &JournalReader{config: config}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	if config.MaxEntriesPerSecond > 0 {
+		r.limiter = newRateLimiter(config.MaxEntriesPerSecond, time.Now())
+	}
 
-	var err error
 	// Open the journal
-	if r.Journal, err = NewJournal(); err != nil {
+	if len(config.Files) > 0 {
+		r.Journal, err = NewJournalFromFiles(config.Files...)
+	} else if config.Path != "" {
+		r.Journal, err = NewJournalFromDir(config.Path)
+	} else if config.Namespace != "" {
+		r.Journal, err = NewJournalFromNamespace(config.Namespace)
+	} else if config.OpenFlags != nil {
+		r.Journal, err = NewJournalWithFlags(*config.OpenFlags)
+	} else {
+		r.Journal, err = NewJournal()
+	}
+	if err != nil {
 		return nil, err
 	}
+	// Release the journal if any of the steps below fails
+	defer func() {
+		if err != nil {
+			r.Close()
+		}
+	}()
+
+	if err := r.Journal.SetDataThreshold(config.DataThreshold); err != nil {
+		return nil, err
+	}
+
+	// Listing boots flushes matches, so look the boot up before adding any
+	if config.BootOffset != nil {
+		boots, err := r.Journal.ListBoots()
+		if err != nil {
+			return nil, err
+		}
+		boot, err := findBoot(boots, *config.BootOffset)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, Match{Field: SD_JOURNAL_FIELD_BOOT_ID, Value: boot.BootID})
+	}
+
+	// Add any supplied match groups, OR'ing the groups together
+	for i, group := range config.MatchGroups {
+		if i > 0 {
+			if err := r.Journal.AddDisjunction(); err != nil {
+				return nil, err
+			}
+		}
+		for _, m := range group {
+			if err := r.Journal.AddMatch(m.String()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Matches further restrict whatever the match groups selected
+	if len(config.MatchGroups) > 0 && len(matches) > 0 {
+		if err := r.Journal.AddConjunction(); err != nil {
+			return nil, err
+		}
+	}
 
-	// Add any supplied matches
-	for _, m := range config.Matches {
-		r.Journal.AddMatch(m.String())
+	// Add any supplied matches, along with those MaxPriority and
+	// BootOffset translate to
+	for _, m := range matches {
+		if err := r.Journal.AddMatch(m.String()); err != nil {
+			return nil, err
+		}
 	}
 
 	// Set the start position based on options
-	if config.Since != 0 {
+	if config.BootID != "" {
+		// Start based on a monotonic time within a boot
+		if err := r.Journal.SeekMonotonicUsec(config.BootID, config.MonotonicUsec); err != nil {
+			return nil, err
+		}
+	} else if config.Cursor != "" {
+		// Start right after the entry the cursor points to. Stepping onto
+		// the sought entry makes the next read return the one following it.
+		found, err := r.Journal.SeekCursorAndNext(config.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, ErrCursorNotFound
+		}
+	} else if config.SeekHead {
+		// Start at the beginning of the journal
+		if err := r.Journal.SeekHead(); err != nil {
+			return nil, err
+		}
+	} else if config.Since != 0 {
 		// Start based on a relative time
 		start := time.Now().Add(config.Since)
 		if err := r.Journal.SeekRealtimeUsec(uint64(start.UnixNano() / 1000)); err != nil {
 			return nil, err
 		}
+	} else if config.Reverse {
+		// Start at the tail and walk back from there; NumFromTail only
+		// bounds the number of entries read
+		if err := r.Journal.SeekTail(); err != nil {
+			return nil, err
+		}
 	} else if config.NumFromTail != 0 {
 		// Start based on a number of lines before the tail
 		if err := r.Journal.SeekTail(); err != nil {
@@ -80,89 +409,373 @@ func NewJournalReader(config JournalReaderConfig) (*JournalReader, error) {
 		// Move the read pointer into position near the tail. Go one further than
 		// the option so that the initial cursor advancement positions us at the
 		// correct starting point.
-		if _, err := r.Journal.PreviousSkip(config.NumFromTail + 1); err != nil {
+		skipped, err := r.Journal.PreviousSkip(config.NumFromTail + 1)
+		if err != nil {
 			return nil, err
 		}
+
+		// If the journal holds fewer entries than requested, we stopped at
+		// the oldest one, which the initial advancement would skip over.
+		// Start at the head instead so that all of them are read.
+		r.tail = config.NumFromTail
+		if skipped <= config.NumFromTail {
+			r.tail = skipped
+			if err := r.Journal.SeekHead(); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return r, nil
 }
 
-func (r *JournalReader) Read(b []byte) (int, error) {
-	var err error
-	var c int
+// limitPriority returns matches restricted to entries with a PRIORITY of at
+// most max. The journal ORs matches on the same field, so PRIORITY matches
+// already in matches are filtered rather than added to, which would select
+// every priority up to max whatever they asked for.
+func limitPriority(matches []Match, max int) ([]Match, error) {
+	priorities, err := MatchPriorityRange(0, max)
+	if err != nil {
+		return nil, err
+	}
+
+	limited := make([]Match, 0, len(matches))
+	found, kept := false, false
+	for _, m := range matches {
+		if m.Field != SD_JOURNAL_FIELD_PRIORITY {
+			limited = append(limited, m)
+			continue
+		}
+		found = true
+		if p, err := strconv.Atoi(m.Value); err == nil && p >= 0 && p <= max {
+			limited = append(limited, m)
+			kept = true
+		}
+	}
 
-	// Advance the journal cursor
-	c, err = r.Journal.Next()
+	if !found {
+		return append(limited, priorities...), nil
+	}
+	if !kept {
+		return nil, fmt.Errorf("no PRIORITY match is within MaxPriority %d", max)
+	}
+	return limited, nil
+}
 
-	// An unexpected error
+// checkJournalDir makes sure dir exists and holds journal files, either
+// directly or in a per-machine subdirectory as found under /var/log/journal.
+func checkJournalDir(dir string) error {
+	fi, err := os.Stat(dir)
 	if err != nil {
-		return 0, err
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("journal path %q is not a directory", dir)
 	}
 
-	// EOF detection
-	if c == 0 {
-		return 0, io.EOF
+	for _, pattern := range []string{"*.journal", "*/*.journal"} {
+		files, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return err
+		}
+		if len(files) > 0 {
+			return nil
+		}
 	}
 
-	// Build a message
-	var msg string
-	msg, err = r.buildJsonMessage()
+	return fmt.Errorf("no journal files found in %q", dir)
+}
 
-	if err != nil {
-		return 0, err
+// Read reads the next serialized journal entry into b. If b is too small to
+// hold the whole entry, the remainder is returned by subsequent calls before
+// moving on to the next entry.
+func (r *JournalReader) Read(b []byte) (int, error) {
+	return r.read(b, r.next)
+}
+
+// read implements Read, getting entries from next.
+func (r *JournalReader) read(b []byte, next func() (JournalEntry, error)) (int, error) {
+	var err error
+
+	if len(r.msg) == 0 {
+		var entry JournalEntry
+
+		// Advance to the next entry
+		entry, err = next()
+
+		if err != nil {
+			return 0, err
+		}
+
+		// Build a message
+		var msg string
+		switch r.config.OutputFormat {
+		case FormatExport:
+			msg, err = r.buildExportMessage(entry)
+		case FormatShortText:
+			if r.pending != nil {
+				// A rate limiting marker rather than the current entry
+				msg = fmt.Sprintf("%s %s\n", r.formatTime(entry.Time()), entry.Message())
+			} else {
+				msg, err = r.buildMessage()
+			}
+		default:
+			msg, err = r.buildJsonMessage(entry)
+		}
+		r.ReleaseEntry(entry)
+
+		if err != nil {
+			return 0, err
+		}
+
+		r.msg = []byte(msg)
 	}
 
-	// Copy and return the message
-	copy(b, []byte(msg))
+	// Copy as much of the message as fits and keep the rest for later
+	c := copy(b, r.msg)
+	r.msg = r.msg[c:]
 
-	return len(msg), nil
+	return c, nil
 }
 
+// ReadEntry advances to the next entry and returns its fields. Besides the
+// entry's own fields, the returned map holds the __CURSOR,
+// __REALTIME_TIMESTAMP and __MONOTONIC_TIMESTAMP (both uint64 microseconds)
+// and __BOOT_ID of the entry, captured along with the fields so that they
+// always describe the same entry.
 func (r *JournalReader) ReadEntry() (JournalEntry, error) {
-	var err error
-	var c int
+	return r.next()
+}
+
+// ReleaseEntry hands an entry obtained from ReadEntry or FollowJournal back to
+// the reader for reuse when ReuseEntries is set, and is a no-op otherwise.
+// The entry must not be used anymore afterwards.
+func (r *JournalReader) ReleaseEntry(entry JournalEntry) {
+	if r.config.ReuseEntries && entry != nil {
+		r.entries.Put(entry)
+	}
+}
+
+// ReadEntryContext works like ReadEntry, but rather than returning io.EOF at
+// the tail of the journal it blocks until a new entry is available, or returns
+// ErrExpired once ctx is done. If the reader is closed meanwhile, it returns
+// io.EOF.
+func (r *JournalReader) ReadEntryContext(ctx context.Context) (JournalEntry, error) {
+	ctx, cancel := r.withReader(ctx)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if r.closed() {
+				return nil, io.EOF
+			}
+			return nil, ErrExpired
+		default:
+		}
+
+		msg, err := r.nextEntry()
+		if err != io.EOF {
+			return msg, err
+		}
 
-	// Advance the journal cursor
-	c, err = r.Journal.Next()
+		if _, err := r.Journal.WaitContext(ctx); err != nil {
+			if r.closed() {
+				return nil, io.EOF
+			}
+			if ctx.Err() != nil {
+				return nil, ErrExpired
+			}
+			return nil, err
+		}
+	}
+}
 
-	// An unexpected error
+// withReader returns a child of ctx which is also done once the reader is
+// closed, so that waiting for new entries stops then.
+func (r *JournalReader) withReader(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	if r.ctx != nil {
+		go func() {
+			select {
+			case <-r.ctx.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return ctx, cancel
+}
+
+// closed reports whether Close was called.
+func (r *JournalReader) closed() bool {
+	return r.ctx != nil && r.ctx.Err() != nil
+}
+
+// ReadEntryFull works like ReadEntry, but also returns the realtime and
+// monotonic timestamps, the cursor and, when supported, the sequence number
+// of the entry.
+func (r *JournalReader) ReadEntryFull() (*JournalEntryFull, error) {
+	fields, err := r.next()
 	if err != nil {
 		return nil, err
 	}
 
-	// EOF detection
-	if c == 0 {
-		return nil, io.EOF
+	e := &JournalEntryFull{Fields: fields}
+	if e.Cursor, err = r.Journal.GetCursor(); err != nil {
+		return nil, err
+	}
+	if e.RealtimeUsec, err = r.Journal.GetRealtimeUsec(); err != nil {
+		return nil, err
+	}
+	if e.MonotonicUsec, e.BootID, err = r.Journal.GetMonotonicUsec(); err != nil {
+		return nil, err
+	}
+	if e.Seqnum, e.SeqnumID, err = r.Journal.GetSeqnum(); err != nil && err != ErrSeqnumNotSupported {
+		return nil, err
 	}
 
-	// Build a message
-	var msg JournalEntry
-	msg, err = r.buildRawMessage()
+	return e, nil
+}
 
-	if err != nil {
+// EntriesBetween returns the entries logged from start to end included, in
+// chronological order, moving the read pointer as needed: reading carries on
+// after the first entry past end, if any. Matches and FilterFunc apply as
+// usual. If limit is not zero, at most that many entries are returned, so as
+// to bound the memory used for wide ranges; reading then carries on after the
+// last entry returned. EntriesBetween returns ErrExpired if ctx is done first,
+// and cannot be used with Reverse.
+func (r *JournalReader) EntriesBetween(ctx context.Context, start, end time.Time, limit uint64) ([]JournalEntry, error) {
+	if r.config.Reverse {
+		return nil, errors.New("EntriesBetween cannot be used with Reverse")
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("invalid range: end %v is before start %v", end, start)
+	}
+
+	if err := r.Journal.SeekRealtimeUsec(uint64(start.UnixNano() / 1000)); err != nil {
 		return nil, err
 	}
+	r.msg = nil
+
+	return r.collect(ctx, limit, func(entry JournalEntry) bool {
+		return !entry.Time().After(end)
+	})
+}
+
+// Drain returns the entries from the read pointer up to the current tail of
+// the journal, even in Follow mode, after which reading carries on as
+// usual. If limit is not zero, at most that many entries are returned, and
+// the remaining ones are left for later calls. Drain returns ErrExpired if
+// ctx is done first.
+func (r *JournalReader) Drain(ctx context.Context, limit uint64) ([]JournalEntry, error) {
+	return r.collect(ctx, limit, nil)
+}
+
+// collect reads entries until the end of the journal, the first one rejected
+// by keep, if set, or limit of them, if not zero.
+func (r *JournalReader) collect(ctx context.Context, limit uint64, keep func(JournalEntry) bool) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	for limit == 0 || uint64(len(entries)) < limit {
+		select {
+		case <-ctx.Done():
+			return nil, ErrExpired
+		default:
+		}
+
+		entry, err := r.nextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if keep != nil && !keep(entry) {
+			r.ReleaseEntry(entry)
+			break
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Catalog returns the message catalog text for the entry most recently
+// returned by Read or ReadEntry, or an empty string if there is none.
+func (r *JournalReader) Catalog() (string, error) {
+	catalog, err := r.Journal.GetCatalog()
+	if err == ErrNoCatalogEntry {
+		return "", nil
+	}
+	return catalog, err
+}
+
+// Cursor returns the cursor of the entry most recently returned by Read or
+// ReadEntry. It may be persisted and later passed back through
+// JournalReaderConfig.Cursor to resume reading. Entries returned by
+// ReadEntry also carry it under the __CURSOR key.
+func (r *JournalReader) Cursor() (string, error) {
+	return r.Journal.GetCursor()
+}
+
+// SetMatches replaces all the filters of the reader, including MatchGroups and
+// MaxPriority, with the given matches. As the read position is not updated,
+// the journal should be re-seeked afterwards, e.g. with Journal.SeekTail.
+func (r *JournalReader) SetMatches(matches []Match) error {
+	r.Journal.FlushMatches()
+
+	for _, m := range matches {
+		if err := r.Journal.AddMatch(m.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
-	return msg, nil
+// NumFromTailAvailable returns how many of the NumFromTail entries requested
+// were available in the journal when the reader was created. It is less than
+// NumFromTail if the journal holds fewer entries, e.g. because older ones were
+// rotated out. It is always 0 when reading in reverse.
+func (r *JournalReader) NumFromTailAvailable() uint64 {
+	return r.tail
+}
+
+// Usage returns the disk space used by the journal files the reader has open,
+// in bytes.
+func (r *JournalReader) Usage() (uint64, error) {
+	return r.Journal.GetUsage()
 }
 
 func (r *JournalReader) Close() error {
+	// Unblock any read waiting for new entries in Follow mode
+	if r.cancel != nil {
+		r.cancel()
+	}
+
+	// No OnIdle call can start anymore, wait for those in progress
+	r.idleMu.Lock()
+	r.idleMu.Unlock()
+	r.idlers.Wait()
+
 	return r.Journal.Close()
 }
 
 // FollowJournal synchronously follows the JournalReader, writing each new journal entry to writer.
 // The follow will continue until any int is received on the until channel. All Journal entries
-// are pushed to the writer channel.
-func (r *JournalReader) FollowJournal(ctx context.Context, writer chan<- JournalEntry) (err error) {
+// are pushed to the writer channel. If MaxEntries is set, FollowJournal returns nil once that many
+// entries have been pushed. If writer is closed, FollowJournal returns ErrWriterClosed.
+func (r *JournalReader) FollowJournal(ctx context.Context, writer chan<- JournalEntry) error {
+
+	var written uint64
 
 	// Process journal entries and events. Entries are flushed until the tail or
 	// timeout is reached, and then we wait for new events or the timeout.
 process:
 	for {
-		msg, err := r.ReadEntry()
+		msg, err := r.followEntry(ctx)
 		if err != nil && err != io.EOF {
-			break process
+			return err
 		}
 
 		select {
@@ -170,60 +783,59 @@ process:
 			return ErrExpired
 		default:
 			if msg != nil {
-				writer <- msg
+				marker := r.pending != nil
+				if err := sendEntry(ctx, writer, msg); err != nil {
+					return err
+				}
+				if marker {
+					continue process
+				}
+				written++
+				if r.config.MaxEntries != 0 && written >= r.config.MaxEntries {
+					return nil
+				}
 				continue process
 			}
 		}
 
 		// We're at the tail, so wait for new events or time out.
-		// Holds journal events to process. Tightly bounded for now unless there's a
-		// reason to unblock the journal watch routine more quickly.
-		events := make(chan int, 1)
-		pollDone := make(chan bool, 1)
-		go func() {
-			for {
-				select {
-				case <-pollDone:
-					return
-				default:
-					events <- r.Journal.Wait(time.Duration(100) * time.Millisecond)
-					return
-				}
-			}
-		}()
+		e, err := r.wait(ctx, r.pollInterval(time.Duration(100)*time.Millisecond))
+		if err != nil {
+			return err
+		}
 
-		select {
-		case <-ctx.Done():
-			pollDone <- true
-			return ErrExpired
-		case e := <-events:
-			pollDone <- true
-			switch e {
-			case SD_JOURNAL_NOP, SD_JOURNAL_APPEND, SD_JOURNAL_INVALIDATE:
-				// TODO: need to account for any of these?
-			default:
-				log.Printf("Received unknown event: %d\n", e)
-			}
-			continue process
+		switch e {
+		case SD_JOURNAL_NOP:
+			r.idle()
+		case SD_JOURNAL_APPEND:
+			// New entries are picked up by the next read
+		case SD_JOURNAL_INVALIDATE:
+			r.invalidate(e)
+		default:
+			r.logf("Received unknown event: %d\n", e)
 		}
 	}
-
-	return
 }
 
 // Follow synchronously follows the JournalReader, writing each new journal entry to writer. The
-// follow will continue until a single time.Time is received on the until channel.
-func (r *JournalReader) Follow(ctx context.Context, writer io.Writer) (err error) {
+// follow will continue until a single time.Time is received on the until channel. If MaxEntries is
+// set, Follow returns nil once that many entries have been written. Any error writing to writer
+// stops the follow and is returned.
+func (r *JournalReader) Follow(ctx context.Context, writer io.Writer) error {
+
+	var written uint64
+
+	var msg = make([]byte, 64*1<<(10))
 
 	// Process journal entries and events. Entries are flushed until the tail or
 	// timeout is reached, and then we wait for new events or the timeout.
 process:
 	for {
-		var msg = make([]byte, 64*1<<(10))
-
-		c, err := r.Read(msg)
+		c, err := r.read(msg, func() (JournalEntry, error) {
+			return r.followEntry(ctx)
+		})
 		if err != nil && err != io.EOF {
-			break process
+			return err
 		}
 
 		select {
@@ -231,80 +843,413 @@ process:
 			return ErrExpired
 		default:
 			if c > 0 {
-				writer.Write(msg)
+				if _, err := writer.Write(msg[:c]); err != nil {
+					return err
+				}
+				// Only count entries once Read has handed out all of them
+				if len(r.msg) == 0 && r.pending == nil {
+					written++
+					if r.config.MaxEntries != 0 && written >= r.config.MaxEntries {
+						return nil
+					}
+				}
 				continue process
 			}
 		}
 
 		// We're at the tail, so wait for new events or time out.
-		// Holds journal events to process. Tightly bounded for now unless there's a
-		// reason to unblock the journal watch routine more quickly.
-		events := make(chan int, 1)
-		pollDone := make(chan bool, 1)
-		go func() {
-			for {
-				select {
-				case <-pollDone:
-					return
-				default:
-					events <- r.Journal.Wait(time.Duration(1) * time.Second)
-				}
+		e, err := r.wait(ctx, r.pollInterval(time.Duration(1)*time.Second))
+		if err != nil {
+			return err
+		}
+
+		switch e {
+		case SD_JOURNAL_NOP:
+			r.idle()
+		case SD_JOURNAL_APPEND:
+			// New entries are picked up by the next read
+		case SD_JOURNAL_INVALIDATE:
+			r.invalidate(e)
+		default:
+			r.logf("Received unknown event: %d\n", e)
+		}
+	}
+}
+
+// next returns the next entry for Read and ReadEntry, waiting for one to be
+// appended at the tail of the journal in Follow mode, until the reader is
+// closed.
+func (r *JournalReader) next() (JournalEntry, error) {
+	if !r.config.Follow {
+		return r.nextEntry()
+	}
+
+	return r.ReadEntryContext(context.Background())
+}
+
+// nextEntry advances to the next entry accepted by FilterFunc and returns its
+// fields, or io.EOF once there are no more entries to read.
+func (r *JournalReader) nextEntry() (JournalEntry, error) {
+	for {
+		// Advance the journal cursor
+		c, err := r.advance()
+
+		// An unexpected error
+		if err != nil {
+			return nil, err
+		}
+
+		// EOF detection
+		if c == 0 {
+			return nil, io.EOF
+		}
+
+		// Build a message
+		msg, err := r.buildRawMessage()
+		if err != nil {
+			return nil, err
+		}
+
+		if catalog, ok := msg["CATALOG_ENTRY"]; ok && r.config.WithCatalog {
+			msg["CATALOG"] = catalog
+		}
+
+		if r.config.FilterFunc == nil || r.config.FilterFunc(msg) {
+			r.count++
+			return msg, nil
+		}
+		r.ReleaseEntry(msg)
+	}
+}
+
+// followEntry returns the next entry for the follow loops, applying
+// MaxEntriesPerSecond: it either waits until the entry may be returned,
+// returning ErrExpired if ctx is done first, or drops it. Once entries were
+// dropped, a marker reporting them is returned ahead of the next entry let
+// through, which is held in pending meanwhile.
+func (r *JournalReader) followEntry(ctx context.Context) (JournalEntry, error) {
+	if r.limiter == nil {
+		return r.nextEntry()
+	}
+
+	if r.pending != nil {
+		msg := r.pending
+		r.pending = nil
+		return msg, nil
+	}
+
+	for {
+		msg, err := r.nextEntry()
+		if msg == nil {
+			return nil, err
+		}
+
+		if !r.config.DropRateLimited {
+			if err := r.limiter.wait(ctx); err != nil {
+				r.ReleaseEntry(msg)
+				return nil, err
 			}
-		}()
+			return msg, nil
+		}
+
+		if !r.limiter.allow(time.Now()) {
+			r.limiter.dropped++
+			r.ReleaseEntry(msg)
+			continue
+		}
+
+		if r.limiter.dropped > 0 {
+			r.pending = msg
+			return r.limiter.marker(time.Now()), nil
+		}
+		return msg, nil
+	}
+}
+
+// advance moves the read pointer one entry in the configured direction,
+// returning 0 once there are no more entries to read.
+func (r *JournalReader) advance() (int, error) {
+	if !r.config.Reverse {
+		return r.Journal.Next()
+	}
+
+	if r.config.NumFromTail != 0 && r.count >= r.config.NumFromTail {
+		return 0, nil
+	}
+
+	c, err := r.Journal.Previous()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(c), nil
+}
 
+// sendEntry pushes msg to writer, returning ErrExpired if ctx is done first,
+// or ErrWriterClosed rather than panicking if writer was closed.
+func sendEntry(ctx context.Context, writer chan<- JournalEntry, msg JournalEntry) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = ErrWriterClosed
+		}
+	}()
+
+	select {
+	case writer <- msg:
+		return nil
+	case <-ctx.Done():
+		return ErrExpired
+	}
+}
+
+// wait blocks until the journal changes or timeout elapses, returning
+// ErrExpired as soon as ctx is done.
+func (r *JournalReader) wait(ctx context.Context, timeout time.Duration) (int, error) {
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	e, err := r.Journal.WaitContext(waitCtx)
+	if ctx.Err() != nil {
+		return 0, ErrExpired
+	}
+	if err == context.DeadlineExceeded {
+		return SD_JOURNAL_NOP, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return e, nil
+}
+
+// rateLimiter is a token bucket holding up to one second worth of entries,
+// refilled at rate entries per second.
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	tokens  float64
+	last    time.Time // when tokens was last refilled
+	dropped uint64    // entries dropped since the last marker
+}
+
+func newRateLimiter(rate float64, now time.Time) *rateLimiter {
+	burst := rate
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+// refill adds the tokens accumulated since the last refill.
+func (l *rateLimiter) refill(now time.Time) {
+	if now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
+
+// allow takes a token if one is available.
+func (l *rateLimiter) allow(now time.Time) bool {
+	l.refill(now)
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+// delay returns how long it takes from now for a token to be available.
+func (l *rateLimiter) delay(now time.Time) time.Duration {
+	l.refill(now)
+	if l.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// wait takes a token, blocking until one is available or ctx is done, in
+// which case it returns ErrExpired.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	for !l.allow(time.Now()) {
+		timer := time.NewTimer(l.delay(time.Now()))
 		select {
+		case <-timer.C:
 		case <-ctx.Done():
-			pollDone <- true
+			timer.Stop()
 			return ErrExpired
-		case e := <-events:
-			pollDone <- true
-			switch e {
-			case SD_JOURNAL_NOP, SD_JOURNAL_APPEND, SD_JOURNAL_INVALIDATE:
-				// TODO: need to account for any of these?
-			default:
-				log.Printf("Received unknown event: %d\n", e)
-			}
-			continue process
 		}
 	}
+	return nil
+}
+
+// marker returns the entry reporting the entries dropped so far, and resets
+// their count.
+func (l *rateLimiter) marker(now time.Time) JournalEntry {
+	msg := JournalEntry{
+		"MESSAGE":              fmt.Sprintf("rate limited, dropped %d entries", l.dropped),
+		"DROPPED":              strconv.FormatUint(l.dropped, 10),
+		"__REALTIME_TIMESTAMP": uint64(now.UnixNano() / 1000),
+	}
+	l.dropped = 0
+	return msg
+}
+
+// invalidate notifies OnInvalidate, if set, that journal files were added or
+// removed.
+func (r *JournalReader) invalidate(event int) {
+	if r.config.OnInvalidate != nil {
+		r.config.OnInvalidate(event)
+	}
+}
+
+// logf reports a diagnostic to the configured Logger, if any.
+func (r *JournalReader) logf(format string, v ...interface{}) {
+	if r.config.Logger != nil {
+		r.config.Logger.Printf(format, v...)
+	}
+}
+
+// idle notifies OnIdle, if set, that waiting for new entries timed out,
+// unless the previous call has not returned yet.
+func (r *JournalReader) idle() {
+	if r.config.OnIdle == nil {
+		return
+	}
+
+	r.idleMu.Lock()
+	defer r.idleMu.Unlock()
+	if r.closed() || r.idling {
+		return
+	}
+	r.idling = true
+	r.idlers.Add(1)
+	go func() {
+		defer r.idlers.Done()
+		r.config.OnIdle()
+
+		r.idleMu.Lock()
+		r.idling = false
+		r.idleMu.Unlock()
+	}()
+}
 
-	return
+// pollInterval returns the configured PollInterval, or def if none was set.
+func (r *JournalReader) pollInterval(def time.Duration) time.Duration {
+	if r.config.PollInterval > 0 {
+		return r.config.PollInterval
+	}
+	return def
 }
 
 // buildMessage returns a string representing the current journal entry in a simple format which
-// includes the entry timestamp and MESSAGE field.
+// includes the entry timestamp and MESSAGE field. The timestamp printed depends on TimestampMode;
+// realtime timestamps are printed as set by TimeFormat and TimeLocation, and monotonic ones as
+// [seconds@bootid].
 func (r *JournalReader) buildMessage() (string, error) {
 	var msg string
-	var usec uint64
 	var err error
 
-	if msg, err = r.Journal.GetData("MESSAGE"); err != nil {
+	if msg, err = r.Journal.GetDataValue("MESSAGE"); err != nil {
 		return "", err
 	}
 
-	if usec, err = r.Journal.GetRealtimeUsec(); err != nil {
-		return "", err
+	var realtime, monotonic string
+
+	if r.config.TimestampMode != TimestampMonotonic {
+		var usec uint64
+		if usec, err = r.Journal.GetRealtimeUsec(); err != nil {
+			return "", err
+		}
+
+		realtime = r.formatTime(time.Unix(0, int64(usec)*int64(time.Microsecond)))
 	}
 
-	timestamp := time.Unix(0, int64(usec)*int64(time.Microsecond))
+	if r.config.TimestampMode != TimestampRealtime {
+		var usec uint64
+		var bootID string
+		if usec, bootID, err = r.Journal.GetMonotonicUsec(); err != nil {
+			return "", err
+		}
+
+		monotonic = fmt.Sprintf("[%d.%06d@%s]", usec/1000000, usec%1000000, bootID)
+	}
 
-	return fmt.Sprintf("%s %s\n", timestamp, msg), nil
+	switch r.config.TimestampMode {
+	case TimestampMonotonic:
+		return fmt.Sprintf("%s %s\n", monotonic, msg), nil
+	case TimestampBoth:
+		return fmt.Sprintf("%s %s %s\n", realtime, monotonic, msg), nil
+	default:
+		return fmt.Sprintf("%s %s\n", realtime, msg), nil
+	}
+}
+
+// formatTime formats a realtime timestamp as configured by TimeFormat and
+// TimeLocation.
+func (r *JournalReader) formatTime(t time.Time) string {
+	layout := r.config.TimeFormat
+	if layout == "" {
+		layout = time.RFC3339Nano
+	}
+	loc := r.config.TimeLocation
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format(layout)
 }
 
 func (r *JournalReader) buildRawMessage() (JournalEntry, error) {
-	fields, err := r.Journal.GetDataAll()
-	if err != nil {
+	// Like GetDataAll, but reusing the maps released by ReleaseEntry
+	var fields JournalEntry
+	if r.config.ReuseEntries {
+		fields, _ = r.entries.Get().(JournalEntry)
+	}
+	if fields == nil {
+		fields = make(JournalEntry)
+	}
+	if err := r.Journal.getDataAll(fields); err != nil {
+		if r.config.ReuseEntries {
+			r.entries.Put(fields)
+		}
 		return nil, err
 	}
+	r.Journal.addCatalogEntry(fields)
 	return fields, nil
 }
 
-func (r *JournalReader) buildJsonMessage() (string, error) {
-	fields, err := r.Journal.GetDataAll()
-	if err != nil {
-		return "", err
+// buildJsonMessage returns a string representing fields as a single line JSON
+// object. Like journalctl -o json, values which are not valid UTF-8 are
+// written as arrays of byte values so that they can be recovered exactly, and
+// repeated fields are written as arrays of their values. Fields are written
+// in alphabetical order, as encoding/json sorts map keys, so the same entry is
+// always serialized identically.
+func (r *JournalReader) buildJsonMessage(fields JournalEntry) (string, error) {
+	out := make(map[string]interface{}, len(fields))
+	for name, value := range fields {
+		switch v := value.(type) {
+		case []byte:
+			out[name] = byteValues(v)
+		case [][]byte:
+			// Like journalctl, only the values which are not valid
+			// UTF-8 are written as byte arrays
+			values := make([]interface{}, len(v))
+			for i, b := range v {
+				if utf8.Valid(b) {
+					values[i] = string(b)
+				} else {
+					values[i] = byteValues(b)
+				}
+			}
+			out[name] = values
+		default:
+			out[name] = value
+		}
 	}
-	b, err := json.Marshal(fields)
+
+	b, err := json.Marshal(out)
 	if err != nil {
 		return "", err
 	}
@@ -312,6 +1257,78 @@ func (r *JournalReader) buildJsonMessage() (string, error) {
 	//return fmt.Sprintf("%s\n", printme(fields)), err
 }
 
+// buildExportMessage returns a string representing fields in the journal
+// export format, terminated by the empty line separating entries. Values that
+// contain newlines or are not valid UTF-8 are written in the binary framing,
+// i.e. the field name on its own line followed by the value size as a 64-bit
+// little endian integer, the raw value and a newline.
+// See http://www.freedesktop.org/wiki/Software/systemd/export/
+func (r *JournalReader) buildExportMessage(fields JournalEntry) (string, error) {
+	buf := new(bytes.Buffer)
+
+	// The address fields come first, in this order
+	for _, name := range []string{"__CURSOR", "__REALTIME_TIMESTAMP", "__MONOTONIC_TIMESTAMP"} {
+		if v, ok := fields[name]; ok {
+			fmt.Fprintf(buf, "%s=%v\n", name, v)
+		}
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		// Skip the address fields along with other synthetic ones, such as
+		// __BOOT_ID which duplicates _BOOT_ID.
+		if !strings.HasPrefix(name, "__") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		switch v := fields[name].(type) {
+		case string:
+			appendExportField(buf, name, []byte(v))
+		case []byte:
+			appendExportField(buf, name, v)
+		case []string:
+			for _, s := range v {
+				appendExportField(buf, name, []byte(s))
+			}
+		case [][]byte:
+			for _, b := range v {
+				appendExportField(buf, name, b)
+			}
+		default:
+			return "", fmt.Errorf("unexpected type %T for field %s", v, name)
+		}
+	}
+
+	buf.WriteByte('\n')
+	return buf.String(), nil
+}
+
+func appendExportField(buf *bytes.Buffer, name string, value []byte) {
+	if bytes.IndexByte(value, '\n') < 0 && utf8.Valid(value) {
+		fmt.Fprintf(buf, "%s=%s\n", name, value)
+		return
+	}
+
+	buf.WriteString(name)
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.Write(value)
+	buf.WriteByte('\n')
+}
+
+// byteValues converts b so that it is marshalled as a JSON array of numbers
+// rather than a base64 string.
+func byteValues(b []byte) []int {
+	values := make([]int, len(b))
+	for i, c := range b {
+		values[i] = int(c)
+	}
+	return values
+}
+
 func printWithType(m map[string]interface{}) string {
 	s := "{\n"
 	for k, v := range m {
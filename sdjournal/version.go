@@ -0,0 +1,88 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdjournal
+
+/*
+#define _GNU_SOURCE
+#include <dlfcn.h>
+#include <stdlib.h>
+
+static int
+has_symbol(const char *name)
+{
+  return dlsym(RTLD_DEFAULT, name) != NULL;
+}
+*/
+import "C"
+import (
+	"errors"
+	"unsafe"
+)
+
+// ErrUnknownVersion is returned by LibsystemdVersion when libsystemd is
+// older than any of the releases it can recognize.
+var ErrUnknownVersion = errors.New("unknown libsystemd version")
+
+// versionSymbols lists, newest first, a symbol of sd-journal introduced by
+// each systemd release that added features used by this package.
+var versionSymbols = []struct {
+	version int
+	symbol  string
+}{
+	{254, "sd_journal_get_seqnum"},
+	{246, "sd_journal_enumerate_available_data"},
+	{245, "sd_journal_open_namespace"},
+	{230, "sd_journal_open_directory_fd"},
+	{229, "sd_journal_enumerate_fields"},
+}
+
+// LibsystemdVersion returns the version of the libsystemd linked at runtime.
+// libsystemd does not report its version, so it is inferred from the
+// functions it provides: the result is the newest release that the
+// available functions are known from, a lower bound of the actual version,
+// which is enough to tell whether a feature is supported.
+func LibsystemdVersion() (int, error) {
+	return libsystemdVersion(hasSymbol)
+}
+
+func libsystemdVersion(has func(symbol string) bool) (int, error) {
+	for _, v := range versionSymbols {
+		if has(v.symbol) {
+			return v.version, nil
+		}
+	}
+	return 0, ErrUnknownVersion
+}
+
+// HasNamespaces reports whether libsystemd supports journal namespaces, as
+// read with NewJournalFromNamespace. They require systemd 245 or newer.
+func HasNamespaces() bool {
+	return hasSymbol("sd_journal_open_namespace")
+}
+
+// HasSeqnum reports whether libsystemd supports reading sequence numbers
+// with GetSeqnum. They require systemd 254 or newer.
+func HasSeqnum() bool {
+	return hasSymbol("sd_journal_get_seqnum")
+}
+
+// hasSymbol reports whether the given function is provided by the libraries
+// loaded at runtime.
+func hasSymbol(symbol string) bool {
+	s := C.CString(symbol)
+	defer C.free(unsafe.Pointer(s))
+
+	return C.has_symbol(s) != 0
+}
@@ -42,6 +42,9 @@ var (
 )
 
 // Deserialize parses a systemd unit file into a list of UnitOption objects.
+// Lines ending in a backslash are continued on the next line; as in systemd,
+// the backslash and newline are replaced by a single space, and comment lines
+// found within the continuation are dropped.
 func Deserialize(f io.Reader) (opts []*UnitOption, err error) {
 	lexer, optchan, errchan := newLexer(f)
 	go lexer.lex()
@@ -218,11 +221,17 @@ func (l *lexer) lexOptionNameFunc(section string) lexStep {
 func (l *lexer) lexOptionValueFunc(section, name string, partial bytes.Buffer) lexStep {
 	return func() (lexStep, error) {
 		for {
-			line, eof, err := l.toEOL()
+			line, _, err := l.toEOL()
 			if err != nil {
 				return nil, err
 			}
 
+			// like systemd, drop comment lines within a continuation,
+			// which is the only case where partial holds anything
+			if partial.Len() > 0 && isCommentLine(line) {
+				continue
+			}
+
 			if len(bytes.TrimSpace(line)) == 0 {
 				break
 			}
@@ -235,21 +244,15 @@ func (l *lexer) lexOptionValueFunc(section, name string, partial bytes.Buffer) l
 				break
 			}
 
-			if !eof {
-				partial.WriteRune('\n')
-			}
+			// like systemd, replace the backslash and the newline
+			// with a single space when joining the next line
+			partial.Truncate(partial.Len() - 1)
+			partial.WriteRune(' ')
 
 			return l.lexOptionValueFunc(section, name, partial), nil
 		}
 
-		val := partial.String()
-		if strings.HasSuffix(val, "\n") {
-			// A newline was added to the end, so the file didn't end with a backslash.
-			// => Keep the newline
-			val = strings.TrimSpace(val) + "\n"
-		} else {
-			val = strings.TrimSpace(val)
-		}
+		val := strings.TrimSpace(partial.String())
 		l.optchan <- &UnitOption{Section: section, Name: name, Value: val}
 
 		return l.lexNextSectionOrOptionFunc(section), nil
@@ -274,3 +277,10 @@ func (l *lexer) toEOL() ([]byte, bool, error) {
 func isComment(r rune) bool {
 	return r == '#' || r == ';'
 }
+
+// isCommentLine reports whether line is a comment, ignoring leading
+// whitespace.
+func isCommentLine(line []byte) bool {
+	line = bytes.TrimLeftFunc(line, unicode.IsSpace)
+	return len(line) > 0 && isComment(rune(line[0]))
+}
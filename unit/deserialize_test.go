@@ -80,15 +80,41 @@ Environment= "FOO=BAR" "BAZ=QUX"
 			},
 		},
 
-		// line continuations unmodified
+		// line continuations joined with a space
 		{
 			[]byte(`[Unit]
 Description= Unnecessarily wrapped \
     words here
 `),
 			[]*UnitOption{
-				&UnitOption{"Unit", "Description", `Unnecessarily wrapped \
-    words here`},
+				&UnitOption{"Unit", "Description", "Unnecessarily wrapped      words here"},
+			},
+		},
+
+		// continued Environment= joined into a single value
+		{
+			[]byte(`[Service]
+Environment="FOO=BAR" \
+"BAZ=QUX"
+Environment=ONE=1
+`),
+			[]*UnitOption{
+				&UnitOption{"Service", "Environment", "\"FOO=BAR\"  \"BAZ=QUX\""},
+				&UnitOption{"Service", "Environment", "ONE=1"},
+			},
+		},
+
+		// continued ExecStart= joined into a single command line
+		{
+			[]byte(`[Service]
+ExecStart=/usr/bin/docker run --rm \
+--name %p \
+busybox sleep 10
+ExecStop=/usr/bin/docker kill %p
+`),
+			[]*UnitOption{
+				&UnitOption{"Service", "ExecStart", "/usr/bin/docker run --rm  --name %p  busybox sleep 10"},
+				&UnitOption{"Service", "ExecStop", "/usr/bin/docker kill %p"},
 			},
 		},
 
@@ -109,7 +135,7 @@ Description=Bar
 			},
 		},
 
-		// apparent comment lines inside of line continuations not ignored
+		// like systemd, comment lines inside of line continuations ignored
 		{
 			[]byte(`[Unit]
 Description=Bar\
@@ -118,10 +144,15 @@ Description=Bar\
 Description=Bar\
 # comment bravo \
 Baz
+
+Description=Foo \
+  ; comment charlie
+bar
 `),
 			[]*UnitOption{
-				&UnitOption{"Unit", "Description", "Bar\\\n# comment alpha"},
-				&UnitOption{"Unit", "Description", "Bar\\\n# comment bravo \\\nBaz"},
+				&UnitOption{"Unit", "Description", "Bar"},
+				&UnitOption{"Unit", "Description", "Bar Baz"},
+				&UnitOption{"Unit", "Description", "Foo  bar"},
 			},
 		},
 
@@ -181,7 +212,7 @@ Description=Bar`),
 			[]byte(`[Unit]
 Description=Bar \`),
 			[]*UnitOption{
-				&UnitOption{"Unit", "Description", "Bar \\"},
+				&UnitOption{"Unit", "Description", "Bar"},
 			},
 		},
 
@@ -219,7 +250,7 @@ Description= words here `),
 Description= words here \
   `),
 			[]*UnitOption{
-				&UnitOption{"Unit", "Description", "words here \\\n"},
+				&UnitOption{"Unit", "Description", "words here"},
 			},
 		},
 
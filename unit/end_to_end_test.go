@@ -37,8 +37,7 @@ ExecStart=/bin/bash -c "while true; do echo \"ping\"; sleep 1; done"
 Description= Unnecessarily wrapped \
     words here`,
 			`[Unit]
-Description=Unnecessarily wrapped \
-    words here
+Description=Unnecessarily wrapped      words here
 `,
 		},
 		{
@@ -48,8 +47,7 @@ Description=Demo \
 Requires=docker.service
 `,
 			`[Unit]
-Description=Demo \
-
+Description=Demo
 Requires=docker.service
 `,
 		},
@@ -66,6 +64,15 @@ Description=Bar
 `,
 			`[Unit]
 Description=Bar
+`},
+		{
+			`[Service]
+ExecStart=/usr/bin/foo \
+# --verbose \
+    --debug
+`,
+			`[Service]
+ExecStart=/usr/bin/foo      --debug
 `},
 	}
 	for i, tt := range tests {
@@ -0,0 +1,240 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode"
+)
+
+// File is a unit file parsed by DeserializeFile. Unlike the flat list
+// returned by Deserialize, it keeps comments, blank lines, key order,
+// duplicate keys and the original formatting of every line, so that
+// serializing an unedited File reproduces its input byte for byte.
+type File struct {
+	Elements []*FileElement
+}
+
+// FileElement is a single piece of a unit file: a section header, an
+// option assignment (including its continuation lines), or any other line
+// such as a comment or a blank line.
+type FileElement struct {
+	// Section is the section the element belongs to; for a section
+	// header it is the name of the section being opened.
+	Section string
+	// Header is true if the element is a section header.
+	Header bool
+	// Option is set for option assignments. It may be edited in place;
+	// edited options are written in the canonical Name=Value form.
+	Option *UnitOption
+
+	raw  string
+	orig UnitOption
+}
+
+// DeserializeFile parses a systemd unit file like Deserialize does, but
+// returns a File preserving the layout of the input.
+func DeserializeFile(f io.Reader) (*File, error) {
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, err := Deserialize(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	elems := splitElements(string(data))
+
+	// Option values come from Deserialize, so that both parse modes
+	// always agree; the elements only carry the original text.
+	i := 0
+	for _, e := range elems {
+		if e.Option == nil {
+			continue
+		}
+		if i >= len(opts) || opts[i].Section != e.Option.Section || opts[i].Name != e.Option.Name {
+			return nil, errors.New("unable to preserve the layout of the unit file")
+		}
+		e.Option = opts[i]
+		e.orig = *opts[i]
+		i++
+	}
+	if i != len(opts) {
+		return nil, errors.New("unable to preserve the layout of the unit file")
+	}
+
+	return &File{Elements: elems}, nil
+}
+
+// splitElements splits data into elements following the same rules as the
+// lexer. Options only carry their section and name.
+func splitElements(data string) []*FileElement {
+	var elems []*FileElement
+	var section string
+
+	lines := splitLines(data)
+	for i := 0; i < len(lines); i++ {
+		raw := lines[i]
+		line := toEOL(raw)
+		trimmed := strings.TrimLeftFunc(line, unicode.IsSpace)
+
+		switch {
+		case trimmed == "":
+			elems = append(elems, &FileElement{Section: section, raw: raw})
+		case trimmed[0] == '[':
+			if end := strings.IndexByte(trimmed, ']'); end != -1 {
+				section = trimmed[1:end]
+			}
+			elems = append(elems, &FileElement{Section: section, Header: true, raw: raw})
+		case isComment(rune(trimmed[0])):
+			// comments may be continued with a trailing backslash
+			for strings.HasSuffix(strings.TrimSuffix(line, " "), "\\") && i+1 < len(lines) {
+				i++
+				raw += lines[i]
+				line = toEOL(lines[i])
+			}
+			elems = append(elems, &FileElement{Section: section, raw: raw})
+		case section == "" || !strings.Contains(trimmed, "="):
+			// ignored by the lexer before the first section
+			elems = append(elems, &FileElement{Section: section, raw: raw})
+		default:
+			eq := strings.IndexByte(trimmed, '=')
+			name := strings.TrimSpace(trimmed[:eq])
+			value := trimmed[eq+1:]
+			if strings.TrimSpace(value) != "" {
+				for strings.HasSuffix(value, "\\") && i+1 < len(lines) {
+					i++
+					raw += lines[i]
+					value = toEOL(lines[i])
+					// comment lines within a continuation are
+					// dropped by the lexer, and do not end it
+					for isCommentLine([]byte(value)) && i+1 < len(lines) {
+						i++
+						raw += lines[i]
+						value = toEOL(lines[i])
+					}
+					if strings.TrimSpace(value) == "" {
+						break
+					}
+				}
+			}
+			elems = append(elems, &FileElement{
+				Section: section,
+				Option:  &UnitOption{Section: section, Name: name},
+				raw:     raw,
+			})
+		}
+	}
+
+	return elems
+}
+
+// splitLines splits data into lines, keeping the line endings.
+func splitLines(data string) []string {
+	var lines []string
+	for len(data) > 0 {
+		idx := strings.IndexByte(data, '\n')
+		if idx == -1 {
+			lines = append(lines, data)
+			break
+		}
+		lines = append(lines, data[:idx+1])
+		data = data[idx+1:]
+	}
+	return lines
+}
+
+// toEOL strips the line ending the same way lexer.toEOL does.
+func toEOL(line string) string {
+	line = strings.TrimSuffix(line, "\r")
+	return strings.TrimSuffix(line, "\n")
+}
+
+// Options returns the options of the file in order. The returned options
+// are the ones held by the file, so edits to them are serialized.
+func (f *File) Options() []*UnitOption {
+	var opts []*UnitOption
+	for _, e := range f.Elements {
+		if e.Option != nil {
+			opts = append(opts, e.Option)
+		}
+	}
+	return opts
+}
+
+// AddOption appends opt after the last element of its section, adding the
+// section at the end of the file if it does not exist yet.
+func (f *File) AddOption(opt *UnitOption) {
+	elem := &FileElement{Section: opt.Section, Option: opt}
+
+	last := -1
+	for i, e := range f.Elements {
+		if e.Section == opt.Section && (e.Header || e.Option != nil) {
+			last = i
+		}
+	}
+
+	if last == -1 {
+		if len(f.Elements) > 0 {
+			f.Elements = append(f.Elements, &FileElement{raw: "\n"})
+		}
+		header := &FileElement{Section: opt.Section, Header: true, raw: "[" + opt.Section + "]\n"}
+		f.Elements = append(f.Elements, header, elem)
+		return
+	}
+
+	f.Elements = append(f.Elements, nil)
+	copy(f.Elements[last+2:], f.Elements[last+1:])
+	f.Elements[last+1] = elem
+}
+
+// RemoveOption removes opt, as returned by Options, from the file. It
+// reports whether the option was found.
+func (f *File) RemoveOption(opt *UnitOption) bool {
+	for i, e := range f.Elements {
+		if e.Option == opt {
+			f.Elements = append(f.Elements[:i], f.Elements[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Serialize encodes the file back into the unit file format. Elements that
+// have not been edited are written exactly as they were read.
+func (f *File) Serialize() io.Reader {
+	var buf bytes.Buffer
+
+	for _, e := range f.Elements {
+		if e.Option == nil || (e.raw != "" && *e.Option == e.orig) {
+			buf.WriteString(e.raw)
+			continue
+		}
+		// the last line of the input may lack a newline
+		if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != '\n' {
+			writeNewline(&buf)
+		}
+		writeOption(&buf, e.Option)
+		writeNewline(&buf)
+	}
+
+	return &buf
+}
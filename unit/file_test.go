@@ -0,0 +1,230 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+const commentedService = `#  This file is part of systemd.
+#
+#  systemd is free software; you can redistribute it and/or modify it
+#  under the terms of the GNU Lesser General Public License as published by
+#  the Free Software Foundation; either version 2.1 of the License, or
+#  (at your option) any later version.
+
+[Unit]
+Description=Network Time Synchronization
+Documentation=man:systemd-timesyncd.service(8)
+ConditionCapability=CAP_SYS_TIME
+DefaultDependencies=no
+; ordering
+After=systemd-remount-fs.service systemd-tmpfiles-setup.service systemd-sysusers.service
+Before=time-sync.target sysinit.target shutdown.target
+Conflicts=shutdown.target
+Wants=time-sync.target
+
+[Service]
+Type=notify
+Restart=always
+RestartSec=0
+ExecStart=/usr/lib/systemd/systemd-timesyncd
+  # indented comment
+CapabilityBoundingSet=CAP_SYS_TIME CAP_SETUID CAP_SETGID CAP_SETPCAP CAP_CHOWN CAP_DAC_OVERRIDE CAP_FOWNER
+PrivateTmp = yes
+PrivateDevices=yes
+ProtectSystem=full
+ProtectHome=yes
+WatchdogSec=1min
+Environment="A=1" \
+    "B=2"
+Environment="C=3"
+
+[Install]
+WantedBy=sysinit.target
+`
+
+func TestFileRoundTrip(t *testing.T) {
+	tests := []string{
+		commentedService,
+		``,
+		`# only a comment`,
+		"[Unit]\r\nDescription=Foo\r\n",
+		`[Unit]
+Description=Foo`,
+		`[Unit]
+Description=Demo \
+
+Requires=docker.service
+`,
+		`# comment \
+continued
+[Service]
+ExecStart=/bin/true
+[Unit]
+Description=interleaved sections
+`,
+		`[Service]
+ExecStart=/usr/bin/foo \
+# --verbose
+    --debug
+User=root
+`,
+	}
+
+	for i, tt := range tests {
+		f, err := DeserializeFile(bytes.NewBufferString(tt))
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		out, err := ioutil.ReadAll(f.Serialize())
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+
+		if string(out) != tt {
+			t.Errorf("case %d: incorrect output", i)
+			t.Logf("Expected:\n%q", tt)
+			t.Logf("Actual:\n%q", out)
+		}
+	}
+}
+
+func TestFileOptionsMatchDeserialize(t *testing.T) {
+	f, err := DeserializeFile(bytes.NewBufferString(commentedService))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	opts, err := Deserialize(bytes.NewBufferString(commentedService))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(f.Options(), opts) {
+		t.Errorf("options differ from Deserialize")
+		t.Logf("Expected: %v", opts)
+		t.Logf("Actual: %v", f.Options())
+	}
+}
+
+func TestFileEdit(t *testing.T) {
+	input := `# header comment
+[Unit]
+Description = Foo
+# keep me
+After=network.target
+
+[Service]
+ExecStart=/usr/bin/foo
+Environment=A=1
+`
+
+	f, err := DeserializeFile(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, opt := range f.Options() {
+		switch opt.Name {
+		case "ExecStart":
+			opt.Value = "/usr/bin/bar"
+		case "Environment":
+			f.RemoveOption(opt)
+		}
+	}
+	f.AddOption(NewUnitOption("Unit", "Wants", "network.target"))
+	f.AddOption(NewUnitOption("Install", "WantedBy", "multi-user.target"))
+
+	expect := `# header comment
+[Unit]
+Description = Foo
+# keep me
+After=network.target
+Wants=network.target
+
+[Service]
+ExecStart=/usr/bin/bar
+
+[Install]
+WantedBy=multi-user.target
+`
+
+	out, err := ioutil.ReadAll(f.Serialize())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(out) != expect {
+		t.Errorf("incorrect output")
+		t.Logf("Expected:\n%s", expect)
+		t.Logf("Actual:\n%s", out)
+	}
+}
+
+func TestFileEditContinuationComment(t *testing.T) {
+	input := `[Service]
+ExecStart=/usr/bin/foo \
+# --verbose
+    --debug
+User=root
+Group=root
+`
+
+	f, err := DeserializeFile(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	opts := f.Options()
+	if len(opts) != 3 || opts[0].Value != "/usr/bin/foo      --debug" {
+		t.Fatalf("unexpected options: %v", opts)
+	}
+	opts[0].Value = "/usr/bin/bar"
+	f.RemoveOption(opts[1])
+
+	expect := `[Service]
+ExecStart=/usr/bin/bar
+Group=root
+`
+
+	out, err := ioutil.ReadAll(f.Serialize())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if string(out) != expect {
+		t.Errorf("incorrect output")
+		t.Logf("Expected:\n%s", expect)
+		t.Logf("Actual:\n%s", out)
+	}
+
+	// the edited file must still parse to the edited options
+	reread, err := Deserialize(bytes.NewBuffer(out))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(reread, f.Options()) {
+		t.Errorf("options differ from Deserialize")
+		t.Logf("Expected: %v", f.Options())
+		t.Logf("Actual: %v", reread)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unit
+
+import (
+	"strings"
+)
+
+// Merge computes the effective options of a unit made of base and the given
+// drop-in fragments, applied in order, the way systemd does:
+//
+//   - list directives, such as After= or ExecStartPre=, accumulate,
+//   - any other directive keeps only its last assignment,
+//   - assigning the empty string resets the directive, so that a drop-in
+//     can replace a list with "ExecStart=" followed by "ExecStart=...".
+//     An empty Condition*= or Assert*= resets all conditions or assertions.
+//
+// Surviving options keep their relative order. The input options are not
+// modified.
+func Merge(base []*UnitOption, dropins ...[]*UnitOption) []*UnitOption {
+	var merged []*UnitOption
+
+	apply := func(opts []*UnitOption) {
+		for _, opt := range opts {
+			if opt.Value == "" || !listDirectives[opt.Name] {
+				merged = removeOptions(merged, opt)
+			}
+			if opt.Value != "" {
+				merged = append(merged, NewUnitOption(opt.Section, opt.Name, opt.Value))
+			}
+		}
+	}
+
+	apply(base)
+	for _, dropin := range dropins {
+		apply(dropin)
+	}
+
+	return merged
+}
+
+// removeOptions removes the options overridden by opt from opts.
+func removeOptions(opts []*UnitOption, opt *UnitOption) []*UnitOption {
+	family := ""
+	if opt.Section == "Unit" && opt.Value == "" {
+		for _, prefix := range []string{"Condition", "Assert"} {
+			if strings.HasPrefix(opt.Name, prefix) {
+				family = prefix
+			}
+		}
+	}
+
+	kept := opts[:0]
+	for _, o := range opts {
+		if o.Section == opt.Section && (o.Name == opt.Name || family != "" && strings.HasPrefix(o.Name, family)) {
+			continue
+		}
+		kept = append(kept, o)
+	}
+	return kept
+}
+
+// listDirectives are the directives that may be assigned more than once,
+// each assignment adding to the list.
+var listDirectives = directiveSet(conditionDirectives(), `
+Documentation Requires Requisite Wants BindsTo PartOf Upholds Conflicts
+Before After OnFailure OnSuccess PropagatesReloadTo ReloadPropagatedFrom
+PropagatesStopTo StopPropagatedFrom JoinsNamespaceOf RequiresMountsFor
+WantsMountsFor
+
+Alias WantedBy RequiredBy UpheldBy Also
+
+ExecStart ExecStartPre ExecStartPost ExecCondition ExecReload ExecStop
+ExecStopPost ExecStopPre SuccessExitStatus RestartPreventExitStatus
+RestartForceExitStatus Sockets OpenFile
+
+ListenStream ListenDatagram ListenSequentialPacket ListenFIFO ListenSpecial
+ListenNetlink ListenMessageQueue ListenUSBFunction Symlinks
+
+PathExists PathExistsGlob PathChanged PathModified DirectoryNotEmpty
+
+OnActiveSec OnBootSec OnStartupSec OnUnitActiveSec OnUnitInactiveSec
+OnCalendar
+
+Environment EnvironmentFile PassEnvironment UnsetEnvironment
+SupplementaryGroups CapabilityBoundingSet AmbientCapabilities BindPaths
+BindReadOnlyPaths MountImages ExtensionImages ExtensionDirectories
+RuntimeDirectory StateDirectory CacheDirectory LogsDirectory
+ConfigurationDirectory ReadWritePaths ReadOnlyPaths InaccessiblePaths
+ExecPaths NoExecPaths TemporaryFileSystem RestrictAddressFamilies
+RestrictFileSystems RestrictNamespaces SystemCallFilter
+SystemCallArchitectures SystemCallLog LogExtraFields LogFilterPatterns
+LoadCredential LoadCredentialEncrypted ImportCredential SetCredential
+SetCredentialEncrypted
+
+IODeviceWeight IOReadBandwidthMax IOWriteBandwidthMax IOReadIOPSMax
+IOWriteIOPSMax IODeviceLatencyTargetSec IPAddressAllow IPAddressDeny
+SocketBindAllow SocketBindDeny RestrictNetworkInterfaces NFTSet
+IPIngressFilterPath IPEgressFilterPath BPFProgram DeviceAllow
+DisableControllers BlockIODeviceWeight BlockIOReadBandwidth
+BlockIOWriteBandwidth
+`)
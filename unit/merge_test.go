@@ -0,0 +1,172 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unit
+
+import (
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		base    []*UnitOption
+		dropins [][]*UnitOption
+		output  []*UnitOption
+	}{
+		// no drop-ins leaves the base untouched
+		{
+			[]*UnitOption{
+				&UnitOption{"Unit", "Description", "Foo"},
+				&UnitOption{"Unit", "After", "a.target"},
+			},
+			nil,
+			[]*UnitOption{
+				&UnitOption{"Unit", "Description", "Foo"},
+				&UnitOption{"Unit", "After", "a.target"},
+			},
+		},
+
+		// last assignment wins for single value directives
+		{
+			[]*UnitOption{
+				&UnitOption{"Unit", "Description", "Foo"},
+				&UnitOption{"Service", "Restart", "no"},
+				&UnitOption{"Service", "User", "foo"},
+			},
+			[][]*UnitOption{
+				{&UnitOption{"Service", "Restart", "always"}},
+				{&UnitOption{"Service", "Restart", "on-failure"}},
+			},
+			[]*UnitOption{
+				&UnitOption{"Unit", "Description", "Foo"},
+				&UnitOption{"Service", "User", "foo"},
+				&UnitOption{"Service", "Restart", "on-failure"},
+			},
+		},
+
+		// list directives accumulate
+		{
+			[]*UnitOption{
+				&UnitOption{"Unit", "After", "a.target"},
+				&UnitOption{"Service", "Environment", "A=1"},
+			},
+			[][]*UnitOption{
+				{
+					&UnitOption{"Unit", "After", "b.target"},
+					&UnitOption{"Service", "Environment", "B=2"},
+				},
+			},
+			[]*UnitOption{
+				&UnitOption{"Unit", "After", "a.target"},
+				&UnitOption{"Service", "Environment", "A=1"},
+				&UnitOption{"Unit", "After", "b.target"},
+				&UnitOption{"Service", "Environment", "B=2"},
+			},
+		},
+
+		// reset-then-append replaces a list
+		{
+			[]*UnitOption{
+				&UnitOption{"Service", "ExecStartPre", "/bin/pre"},
+				&UnitOption{"Service", "ExecStart", "/usr/bin/foo"},
+			},
+			[][]*UnitOption{
+				{
+					&UnitOption{"Service", "ExecStart", ""},
+					&UnitOption{"Service", "ExecStart", "/usr/bin/foo --debug"},
+				},
+			},
+			[]*UnitOption{
+				&UnitOption{"Service", "ExecStartPre", "/bin/pre"},
+				&UnitOption{"Service", "ExecStart", "/usr/bin/foo --debug"},
+			},
+		},
+
+		// an empty assignment resets single value directives too
+		{
+			[]*UnitOption{
+				&UnitOption{"Service", "User", "foo"},
+			},
+			[][]*UnitOption{
+				{&UnitOption{"Service", "User", ""}},
+			},
+			nil,
+		},
+
+		// directives are only reset within their section
+		{
+			[]*UnitOption{
+				&UnitOption{"Unit", "Description", "Foo"},
+				&UnitOption{"X-Foo", "Description", "Bar"},
+			},
+			[][]*UnitOption{
+				{&UnitOption{"X-Foo", "Description", ""}},
+			},
+			[]*UnitOption{
+				&UnitOption{"Unit", "Description", "Foo"},
+			},
+		},
+
+		// an empty condition resets all conditions, but not assertions
+		{
+			[]*UnitOption{
+				&UnitOption{"Unit", "ConditionPathExists", "/etc/foo"},
+				&UnitOption{"Unit", "ConditionUser", "root"},
+				&UnitOption{"Unit", "AssertPathExists", "/etc/bar"},
+			},
+			[][]*UnitOption{
+				{
+					&UnitOption{"Unit", "ConditionPathExists", ""},
+					&UnitOption{"Unit", "ConditionHost", "box"},
+				},
+			},
+			[]*UnitOption{
+				&UnitOption{"Unit", "AssertPathExists", "/etc/bar"},
+				&UnitOption{"Unit", "ConditionHost", "box"},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		output := Merge(tt.base, tt.dropins...)
+		if !AllMatch(output, tt.output) {
+			t.Errorf("case %d: incorrect output", i)
+			t.Log("Expected:")
+			logUnitOptionSlice(t, tt.output)
+			t.Log("Actual:")
+			logUnitOptionSlice(t, output)
+		}
+	}
+}
+
+func TestMergeDoesNotModifyInput(t *testing.T) {
+	base := []*UnitOption{
+		&UnitOption{"Service", "ExecStart", "/usr/bin/foo"},
+		&UnitOption{"Service", "User", "foo"},
+	}
+	dropin := []*UnitOption{
+		&UnitOption{"Service", "ExecStart", ""},
+	}
+
+	Merge(base, dropin)
+
+	expect := []*UnitOption{
+		&UnitOption{"Service", "ExecStart", "/usr/bin/foo"},
+		&UnitOption{"Service", "User", "foo"},
+	}
+	if !AllMatch(base, expect) {
+		t.Errorf("base modified")
+		logUnitOptionSlice(t, base)
+	}
+}
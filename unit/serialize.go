@@ -17,6 +17,7 @@ package unit
 import (
 	"bytes"
 	"io"
+	"strings"
 )
 
 // Serialize encodes all of the given UnitOption objects into a
@@ -58,6 +59,43 @@ func Serialize(opts []*UnitOption) io.Reader {
 	return &buf
 }
 
+// SerializeQuoted is like Serialize, but treats option values as literal
+// strings, such as user input, and escapes them so that systemd reads them
+// back unchanged where its syntax allows: percent signs are doubled so they
+// are not expanded as specifiers, and Environment= values, which must be a
+// single KEY=VALUE assignment, are quoted when they contain whitespace,
+// quotes or backslashes.
+//
+// Other values are written as is, except for those that could not be read
+// back unchanged: values with leading or trailing whitespace, which would be
+// trimmed, values ending in a backslash, which would continue on the next
+// line, and values starting with a quote. These are double quoted as a single
+// word, which SplitCommandLine reads back, as do the directives taking quoted
+// words such as ExecStart=. Newlines cannot be represented in the remaining
+// values and are replaced by spaces, as a line continuation would.
+func SerializeQuoted(opts []*UnitOption) io.Reader {
+	quoted := make([]*UnitOption, len(opts))
+	for i, opt := range opts {
+		quoted[i] = NewUnitOption(opt.Section, opt.Name, quoteValue(opt.Name, opt.Value))
+	}
+	return Serialize(quoted)
+}
+
+func quoteValue(name, value string) string {
+	switch {
+	case name == "Environment":
+		if value != "" {
+			value = quoteWord(value)
+		}
+	case value != strings.TrimSpace(value) || strings.HasSuffix(value, "\\") ||
+		strings.HasPrefix(value, "\"") || strings.HasPrefix(value, "'"):
+		value = quoteWord(value)
+	default:
+		value = strings.Replace(value, "\n", " ", -1)
+	}
+	return strings.Replace(value, "%", "%%", -1)
+}
+
 func writeNewline(buf *bytes.Buffer) {
 	buf.WriteRune('\n')
 }
@@ -16,6 +16,7 @@ package unit
 
 import (
 	"io/ioutil"
+	"strings"
 	"testing"
 )
 
@@ -168,3 +169,154 @@ o
 		}
 	}
 }
+
+func TestSerializeQuoted(t *testing.T) {
+	tests := []struct {
+		input  []*UnitOption
+		output string
+	}{
+		// plain values are written unchanged
+		{
+			[]*UnitOption{
+				&UnitOption{"Unit", "Description", "Foo bar"},
+				&UnitOption{"Service", "Environment", "FOO=bar"},
+			},
+			`[Unit]
+Description=Foo bar
+
+[Service]
+Environment=FOO=bar
+`,
+		},
+
+		// Environment values with spaces and quotes are quoted
+		{
+			[]*UnitOption{
+				&UnitOption{"Service", "Environment", "GREETING=hello world"},
+				&UnitOption{"Service", "Environment", `QUOTE=say "hi"`},
+				&UnitOption{"Service", "Environment", `PATH=C:\temp`},
+				&UnitOption{"Service", "Environment", "LINES=a\nb"},
+			},
+			`[Service]
+Environment="GREETING=hello world"
+Environment="QUOTE=say \"hi\""
+Environment="PATH=C:\\temp"
+Environment="LINES=a\nb"
+`,
+		},
+
+		// percent signs are not expanded as specifiers
+		{
+			[]*UnitOption{
+				&UnitOption{"Unit", "Description", "100% done"},
+				&UnitOption{"Service", "Environment", "FMT=%s %d"},
+				&UnitOption{"Service", "ExecStart", "/usr/bin/date +%Y"},
+			},
+			`[Unit]
+Description=100%% done
+
+[Service]
+Environment="FMT=%%s %%d"
+ExecStart=/usr/bin/date +%%Y
+`,
+		},
+
+		// newlines outside of Environment are replaced by spaces
+		{
+			[]*UnitOption{
+				&UnitOption{"Unit", "Description", "Fo\no"},
+			},
+			`[Unit]
+Description=Fo o
+`,
+		},
+
+		// values that would not be read back unchanged are quoted
+		{
+			[]*UnitOption{
+				&UnitOption{"Unit", "Description", `C:\dir\`},
+				&UnitOption{"Unit", "After", "b.service"},
+				&UnitOption{"Unit", "Documentation", "  leading"},
+				&UnitOption{"Unit", "Conflicts", "trailing "},
+				&UnitOption{"Unit", "Wants", `"quoted"`},
+				&UnitOption{"Unit", "Before", "a\\\nb"},
+				&UnitOption{"Unit", "Requires", "a\\\n"},
+			},
+			`[Unit]
+Description="C:\\dir\\"
+After=b.service
+Documentation="  leading"
+Conflicts="trailing "
+Wants="\"quoted\""
+Before=a\ b
+Requires="a\\\n"
+`,
+		},
+	}
+
+	for i, tt := range tests {
+		outBytes, err := ioutil.ReadAll(SerializeQuoted(tt.input))
+		if err != nil {
+			t.Errorf("case %d: encountered error while reading output: %v", i, err)
+			continue
+		}
+
+		output := string(outBytes)
+		if tt.output != output {
+			t.Errorf("case %d: incorrect output", i)
+			t.Logf("Expected:\n%s", tt.output)
+			t.Logf("Actual:\n%s", output)
+		}
+	}
+}
+
+// TestSerializeQuotedRoundTrip ensures that values written by SerializeQuoted
+// are read back by Deserialize as written, and unchanged once unquoted when
+// they had to be quoted.
+func TestSerializeQuotedRoundTrip(t *testing.T) {
+	tests := []struct {
+		value  string
+		quoted bool
+	}{
+		{"plain value", false},
+		{"100% done", false},
+		{`C:\dir\`, true},
+		{`ends in two\\`, true},
+		{"  leading", true},
+		{"trailing  ", true},
+		{"\ttabbed", true},
+		{`"quoted" value`, true},
+		{"'single' value", true},
+		{"a\\\n", true},
+		{"a\\\nb\\", true},
+	}
+
+	for i, tt := range tests {
+		opts := []*UnitOption{
+			&UnitOption{"Unit", "Description", tt.value},
+			&UnitOption{"Unit", "After", "b.service"},
+		}
+		got, err := Deserialize(SerializeQuoted(opts))
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if len(got) != 2 || got[1].Name != "After" || got[1].Value != "b.service" {
+			t.Errorf("case %d: the next option was not read back: %v", i, got)
+			continue
+		}
+
+		value := strings.Replace(got[0].Value, "%%", "%", -1)
+		if tt.quoted {
+			words, err := SplitCommandLine(value)
+			if err != nil || len(words) != 1 {
+				t.Errorf("case %d: %q is not a single quoted word: %v", i, value, err)
+				continue
+			}
+			value = words[0]
+		}
+		if value != tt.value {
+			t.Errorf("case %d: expected %q, got %q", i, tt.value, value)
+		}
+	}
+}
@@ -0,0 +1,445 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unit
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Unit is a typed view of the commonly used options of a unit file.
+// Options that have no typed field are kept in Extra.
+type Unit struct {
+	Unit    UnitSection
+	Service ServiceSection
+	Install InstallSection
+
+	// Extra holds all other options, in the order they were found.
+	Extra []*UnitOption
+}
+
+// UnitSection holds the options of the [Unit] section.
+type UnitSection struct {
+	Description   string
+	Documentation []string
+	Requires      []string
+	Wants         []string
+	BindsTo       []string
+	Conflicts     []string
+	Before        []string
+	After         []string
+}
+
+// ServiceSection holds the options of the [Service] section. Commands are
+// split into their arguments; the first argument keeps any prefix such as
+// "-" or "@".
+type ServiceSection struct {
+	Type             string
+	ExecStartPre     [][]string
+	ExecStart        [][]string
+	ExecStartPost    [][]string
+	ExecReload       [][]string
+	ExecStop         [][]string
+	Environment      map[string]string
+	EnvironmentFile  []string
+	User             string
+	Group            string
+	WorkingDirectory string
+	Restart          string
+	RestartSec       string
+}
+
+// InstallSection holds the options of the [Install] section.
+type InstallSection struct {
+	Alias      []string
+	WantedBy   []string
+	RequiredBy []string
+	Also       []string
+}
+
+type fieldKind int
+
+const (
+	stringField   fieldKind = iota // single value, the last assignment wins
+	listField                      // space separated, accumulated
+	listLineField                  // one item per assignment
+	commandsField                  // one command line per assignment
+	envField                       // quoted KEY=VALUE words
+)
+
+type field struct {
+	section string
+	name    string
+	kind    fieldKind
+	ptr     interface{}
+}
+
+// fields lists the typed options of u in the order ToOptions writes them.
+func (u *Unit) fields() []field {
+	return []field{
+		{"Unit", "Description", stringField, &u.Unit.Description},
+		{"Unit", "Documentation", listField, &u.Unit.Documentation},
+		{"Unit", "Requires", listField, &u.Unit.Requires},
+		{"Unit", "Wants", listField, &u.Unit.Wants},
+		{"Unit", "BindsTo", listField, &u.Unit.BindsTo},
+		{"Unit", "Conflicts", listField, &u.Unit.Conflicts},
+		{"Unit", "Before", listField, &u.Unit.Before},
+		{"Unit", "After", listField, &u.Unit.After},
+
+		{"Service", "Type", stringField, &u.Service.Type},
+		{"Service", "User", stringField, &u.Service.User},
+		{"Service", "Group", stringField, &u.Service.Group},
+		{"Service", "WorkingDirectory", stringField, &u.Service.WorkingDirectory},
+		{"Service", "Environment", envField, &u.Service.Environment},
+		{"Service", "EnvironmentFile", listLineField, &u.Service.EnvironmentFile},
+		{"Service", "ExecStartPre", commandsField, &u.Service.ExecStartPre},
+		{"Service", "ExecStart", commandsField, &u.Service.ExecStart},
+		{"Service", "ExecStartPost", commandsField, &u.Service.ExecStartPost},
+		{"Service", "ExecReload", commandsField, &u.Service.ExecReload},
+		{"Service", "ExecStop", commandsField, &u.Service.ExecStop},
+		{"Service", "Restart", stringField, &u.Service.Restart},
+		{"Service", "RestartSec", stringField, &u.Service.RestartSec},
+
+		{"Install", "Alias", listField, &u.Install.Alias},
+		{"Install", "WantedBy", listField, &u.Install.WantedBy},
+		{"Install", "RequiredBy", listField, &u.Install.RequiredBy},
+		{"Install", "Also", listField, &u.Install.Also},
+	}
+}
+
+// FromOptions builds a Unit from opts, as returned by Deserialize. As in
+// systemd, an empty assignment resets list options.
+func FromOptions(opts []*UnitOption) (*Unit, error) {
+	u := &Unit{}
+
+	fields := make(map[string]field)
+	for _, f := range u.fields() {
+		fields[f.section+"."+f.name] = f
+	}
+
+	for _, opt := range opts {
+		f, ok := fields[opt.Section+"."+opt.Name]
+		if !ok {
+			u.Extra = append(u.Extra, NewUnitOption(opt.Section, opt.Name, opt.Value))
+			continue
+		}
+		if err := f.set(opt.Value); err != nil {
+			return nil, fmt.Errorf("invalid %s= in [%s]: %v", opt.Name, opt.Section, err)
+		}
+	}
+
+	return u, nil
+}
+
+func (f field) set(value string) error {
+	switch p := f.ptr.(type) {
+	case *string:
+		*p = value
+	case *[]string:
+		switch {
+		case value == "":
+			*p = nil
+		case f.kind == listLineField:
+			*p = append(*p, value)
+		default:
+			*p = append(*p, strings.Fields(value)...)
+		}
+	case *[][]string:
+		if value == "" {
+			*p = nil
+			break
+		}
+		cmds, err := SplitCommandLines(value)
+		if err != nil {
+			return err
+		}
+		*p = append(*p, cmds...)
+	case *map[string]string:
+		if value == "" {
+			*p = nil
+			break
+		}
+		words, err := SplitCommandLine(value)
+		if err != nil {
+			return err
+		}
+		for _, w := range words {
+			i := strings.IndexByte(w, '=')
+			if i <= 0 {
+				return fmt.Errorf("%q is not a KEY=VALUE assignment", w)
+			}
+			if *p == nil {
+				*p = make(map[string]string)
+			}
+			(*p)[w[:i]] = w[i+1:]
+		}
+	}
+	return nil
+}
+
+// ToOptions converts u back into a list of options, suitable for
+// Serialize. Typed fields come first, in section order, followed by Extra.
+func (u *Unit) ToOptions() []*UnitOption {
+	var opts []*UnitOption
+
+	for _, f := range u.fields() {
+		for _, v := range f.values() {
+			opts = append(opts, NewUnitOption(f.section, f.name, v))
+		}
+	}
+	for _, opt := range u.Extra {
+		opts = append(opts, NewUnitOption(opt.Section, opt.Name, opt.Value))
+	}
+
+	return opts
+}
+
+func (f field) values() []string {
+	switch p := f.ptr.(type) {
+	case *string:
+		if *p != "" {
+			return []string{*p}
+		}
+	case *[]string:
+		switch {
+		case len(*p) == 0:
+		case f.kind == listLineField:
+			return *p
+		default:
+			return []string{strings.Join(*p, " ")}
+		}
+	case *[][]string:
+		var values []string
+		for _, args := range *p {
+			values = append(values, JoinCommandLine(args))
+		}
+		return values
+	case *map[string]string:
+		var keys []string
+		for k := range *p {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		var values []string
+		for _, k := range keys {
+			values = append(values, quoteWord(k+"="+(*p)[k]))
+		}
+		return values
+	}
+	return nil
+}
+
+// SplitCommandLine splits a command line, such as the value of ExecStart=,
+// into its arguments following systemd's rules: arguments are separated by
+// whitespace, may be quoted with single or double quotes, and support the
+// C-style backslash escapes documented in systemd.service(5). A lone ";"
+// separating several command lines is an error; see SplitCommandLines.
+func SplitCommandLine(s string) ([]string, error) {
+	cmds, err := SplitCommandLines(s)
+	if err != nil {
+		return nil, err
+	}
+	switch len(cmds) {
+	case 0:
+		return nil, nil
+	case 1:
+		return cmds[0], nil
+	}
+	return nil, errors.New("several command lines separated by ;")
+}
+
+// SplitCommandLines works like SplitCommandLine, but also splits the value
+// into several command lines at each lone ";", as allowed in ExecStart= of
+// oneshot services. A literal semicolon argument is written quoted or as
+// "\;". Empty command lines are left out.
+func SplitCommandLines(s string) ([][]string, error) {
+	var cmds [][]string
+	var args []string
+	var arg []byte
+	inArg := false
+	var quote byte
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			if i+1 == len(s) {
+				return nil, errors.New("trailing backslash")
+			}
+			r, n, err := unescapeC(s[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			arg = append(arg, r...)
+			i += n
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				arg = append(arg, c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, string(arg))
+				arg = arg[:0]
+				inArg = false
+			}
+		case c == ';' && !inArg && (i+1 == len(s) || s[i+1] == ' ' || s[i+1] == '\t' || s[i+1] == '\n'):
+			if len(args) > 0 {
+				cmds = append(cmds, args)
+				args = nil
+			}
+		default:
+			arg = append(arg, c)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, string(arg))
+	}
+	if len(args) > 0 {
+		cmds = append(cmds, args)
+	}
+
+	return cmds, nil
+}
+
+// unescapeC decodes the escape sequence at the start of s, which follows a
+// backslash, and returns the decoded bytes and the length of the sequence.
+// As in systemd, escapes decoding to a NUL byte are rejected.
+func unescapeC(s string) ([]byte, int, error) {
+	switch s[0] {
+	case 'a':
+		return []byte{'\a'}, 1, nil
+	case 'b':
+		return []byte{'\b'}, 1, nil
+	case 'f':
+		return []byte{'\f'}, 1, nil
+	case 'n':
+		return []byte{'\n'}, 1, nil
+	case 'r':
+		return []byte{'\r'}, 1, nil
+	case 's':
+		return []byte{' '}, 1, nil
+	case 't':
+		return []byte{'\t'}, 1, nil
+	case 'v':
+		return []byte{'\v'}, 1, nil
+	case '\\', '"', '\'', ' ', ';':
+		return []byte{s[0]}, 1, nil
+	case 'x':
+		b, err := unescapeNumber(s, 2, 16)
+		if err != nil {
+			return nil, 0, err
+		}
+		return []byte{byte(b)}, 3, nil
+	case '0', '1', '2', '3', '4', '5', '6', '7':
+		b, err := unescapeNumber(s, 3, 8)
+		if err != nil {
+			return nil, 0, err
+		}
+		if b > 0xff {
+			return nil, 0, fmt.Errorf("invalid escape sequence \\%s", s[:3])
+		}
+		return []byte{byte(b)}, 3, nil
+	case 'u', 'U':
+		n := 4
+		if s[0] == 'U' {
+			n = 8
+		}
+		r, err := unescapeNumber(s, n, 16)
+		if err != nil {
+			return nil, 0, err
+		}
+		if r > utf8.MaxRune || !utf8.ValidRune(rune(r)) {
+			return nil, 0, fmt.Errorf("invalid escape sequence \\%s", s[:n+1])
+		}
+		buf := make([]byte, utf8.RuneLen(rune(r)))
+		utf8.EncodeRune(buf, rune(r))
+		return buf, n + 1, nil
+	}
+	return nil, 0, fmt.Errorf("invalid escape sequence \\%c", s[0])
+}
+
+// unescapeNumber parses the n digits in the given base of the numeric escape
+// sequence s, which starts with its letter for all bases but 8.
+func unescapeNumber(s string, n int, base int) (uint64, error) {
+	digits := s
+	if base != 8 {
+		digits = s[1:]
+	}
+	if len(digits) < n {
+		return 0, fmt.Errorf("invalid escape sequence \\%s", s)
+	}
+	v, err := strconv.ParseUint(digits[:n], base, 32)
+	if err != nil || v == 0 {
+		return 0, fmt.Errorf("invalid escape sequence \\%s", s[:len(s)-len(digits)+n])
+	}
+	return v, nil
+}
+
+// JoinCommandLine is the inverse of SplitCommandLine: it joins args into a
+// command line, quoting the arguments that need it.
+func JoinCommandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteWord(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// quoteWord double quotes s if SplitCommandLine would not return it as a
+// single word otherwise.
+func quoteWord(s string) string {
+	if s != "" && s != ";" && !strings.ContainsAny(s, " \t\n\r\v\f\"'\\") {
+		return s
+	}
+
+	var buf []byte
+	buf = append(buf, '"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			buf = append(buf, '\\', c)
+		case '\n':
+			buf = append(buf, `\n`...)
+		case '\r':
+			buf = append(buf, `\r`...)
+		case '\t':
+			buf = append(buf, `\t`...)
+		case '\v':
+			buf = append(buf, `\v`...)
+		case '\f':
+			buf = append(buf, `\f`...)
+		default:
+			buf = append(buf, c)
+		}
+	}
+	buf = append(buf, '"')
+	return string(buf)
+}
@@ -0,0 +1,264 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unit
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommandLine(t *testing.T) {
+	tests := []struct {
+		in   string
+		args []string
+		err  bool
+	}{
+		{``, nil, false},
+		{`/bin/true`, []string{"/bin/true"}, false},
+		{`  /bin/echo   a  b `, []string{"/bin/echo", "a", "b"}, false},
+		{`-/bin/echo "a b" 'c d'`, []string{"-/bin/echo", "a b", "c d"}, false},
+		{`/bin/echo a"b c"d`, []string{"/bin/echo", "ab cd"}, false},
+		{`/bin/echo ""`, []string{"/bin/echo", ""}, false},
+		{`/bin/echo "say \"hi\"" a\ b \x41\t`, []string{"/bin/echo", `say "hi"`, "a b", "A\t"}, false},
+		{`/bin/sh -c 'echo $HOME'`, []string{"/bin/sh", "-c", "echo $HOME"}, false},
+		{`/bin/echo "unterminated`, nil, true},
+		{`/bin/echo trailing\`, nil, true},
+		{`/bin/echo \q`, nil, true},
+		{`/bin/echo \x4`, nil, true},
+		{`/bin/echo \101\x42\u00e9\U0001F600`, []string{"/bin/echo", "ABé\U0001F600"}, false},
+		{`/bin/echo \18`, nil, true},
+		{`/bin/echo \400`, nil, true},
+		{`/bin/echo \000`, nil, true},
+		{`/bin/echo \ud800`, nil, true},
+		{`/bin/echo \U00110000`, nil, true},
+		{`/bin/echo \; ";" a;b`, []string{"/bin/echo", ";", ";", "a;b"}, false},
+		{`/bin/echo ; /bin/true`, nil, true},
+	}
+
+	for i, tt := range tests {
+		args, err := SplitCommandLine(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("case %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("case %d: expected %q, got %q", i, tt.args, args)
+		}
+
+		if tt.args == nil {
+			continue
+		}
+		again, err := SplitCommandLine(JoinCommandLine(args))
+		if err != nil || !reflect.DeepEqual(again, args) {
+			t.Errorf("case %d: JoinCommandLine(%q) = %q does not split back", i, args, JoinCommandLine(args))
+		}
+	}
+}
+
+func TestSplitCommandLines(t *testing.T) {
+	tests := []struct {
+		in   string
+		cmds [][]string
+	}{
+		{``, nil},
+		{`/bin/true`, [][]string{{"/bin/true"}}},
+		{`/bin/echo ; /bin/true`, [][]string{{"/bin/echo"}, {"/bin/true"}}},
+		{`/bin/echo a ;/bin/true`, [][]string{{"/bin/echo", "a", ";/bin/true"}}},
+		{`/bin/echo \; ";" ; /bin/true ;`, [][]string{{"/bin/echo", ";", ";"}, {"/bin/true"}}},
+		{`; /bin/true ; ;`, [][]string{{"/bin/true"}}},
+	}
+
+	for i, tt := range tests {
+		cmds, err := SplitCommandLines(tt.in)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(cmds, tt.cmds) {
+			t.Errorf("case %d: expected %q, got %q", i, tt.cmds, cmds)
+		}
+	}
+}
+
+func TestFromOptions(t *testing.T) {
+	input := `[Unit]
+Description=Etcd Server
+Documentation=https://github.com/coreos/etcd man:etcd(1)
+After=network.target
+After=local-fs.target
+X-Custom=kept
+
+[Service]
+Type=notify
+User=etcd
+Environment=ETCD_NAME=default "ETCD_DATA_DIR=/var/lib/etcd data"
+Environment=GOMAXPROCS=4
+ExecStartPre=-/usr/bin/mkdir -p /var/lib/etcd
+ExecStartPre=/usr/bin/chown etcd /var/lib/etcd
+ExecStart=/usr/bin/etcd \
+  --name "${ETCD_NAME}" \
+  --data-dir '${ETCD_DATA_DIR}'
+Restart=on-failure
+LimitNOFILE=65536
+
+[Install]
+WantedBy=multi-user.target
+`
+
+	opts, err := Deserialize(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	u, err := FromOptions(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expect := &Unit{
+		Unit: UnitSection{
+			Description:   "Etcd Server",
+			Documentation: []string{"https://github.com/coreos/etcd", "man:etcd(1)"},
+			After:         []string{"network.target", "local-fs.target"},
+		},
+		Service: ServiceSection{
+			Type: "notify",
+			User: "etcd",
+			Environment: map[string]string{
+				"ETCD_NAME":     "default",
+				"ETCD_DATA_DIR": "/var/lib/etcd data",
+				"GOMAXPROCS":    "4",
+			},
+			ExecStartPre: [][]string{
+				{"-/usr/bin/mkdir", "-p", "/var/lib/etcd"},
+				{"/usr/bin/chown", "etcd", "/var/lib/etcd"},
+			},
+			ExecStart: [][]string{
+				{"/usr/bin/etcd", "--name", "${ETCD_NAME}", "--data-dir", "${ETCD_DATA_DIR}"},
+			},
+			Restart: "on-failure",
+		},
+		Install: InstallSection{
+			WantedBy: []string{"multi-user.target"},
+		},
+		Extra: []*UnitOption{
+			&UnitOption{"Unit", "X-Custom", "kept"},
+			&UnitOption{"Service", "LimitNOFILE", "65536"},
+		},
+	}
+
+	if !reflect.DeepEqual(u, expect) {
+		t.Errorf("unexpected unit")
+		t.Logf("Expected: %#v", expect)
+		t.Logf("Actual: %#v", u)
+	}
+
+	// ToOptions must produce options that parse back to the same unit
+	again, err := FromOptions(u.ToOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(again, u) {
+		t.Errorf("unit changed after ToOptions")
+		t.Logf("Expected: %#v", u)
+		t.Logf("Actual: %#v", again)
+	}
+}
+
+func TestFromOptionsReset(t *testing.T) {
+	opts := []*UnitOption{
+		&UnitOption{"Unit", "After", "a.target"},
+		&UnitOption{"Unit", "After", ""},
+		&UnitOption{"Unit", "After", "b.target"},
+		&UnitOption{"Service", "Environment", "A=1"},
+		&UnitOption{"Service", "Environment", ""},
+	}
+
+	u, err := FromOptions(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(u.Unit.After, []string{"b.target"}) {
+		t.Errorf("unexpected After: %q", u.Unit.After)
+	}
+	if u.Service.Environment != nil {
+		t.Errorf("unexpected Environment: %v", u.Service.Environment)
+	}
+}
+
+func TestFromOptionsCommands(t *testing.T) {
+	opts := []*UnitOption{
+		&UnitOption{"Service", "Type", "oneshot"},
+		&UnitOption{"Service", "ExecStart", "/usr/bin/false"},
+		&UnitOption{"Service", "ExecStart", ""},
+		&UnitOption{"Service", "ExecStart", "/usr/bin/foo --one"},
+		&UnitOption{"Service", "ExecStart", "/usr/bin/foo --two ; /usr/bin/foo --three"},
+		&UnitOption{"Service", "ExecStop", "/usr/bin/foo --stop"},
+		&UnitOption{"Service", "ExecStop", "-/usr/bin/cleanup"},
+	}
+
+	u, err := FromOptions(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expect := ServiceSection{
+		Type: "oneshot",
+		ExecStart: [][]string{
+			{"/usr/bin/foo", "--one"},
+			{"/usr/bin/foo", "--two"},
+			{"/usr/bin/foo", "--three"},
+		},
+		ExecStop: [][]string{
+			{"/usr/bin/foo", "--stop"},
+			{"-/usr/bin/cleanup"},
+		},
+	}
+	if !reflect.DeepEqual(u.Service, expect) {
+		t.Errorf("unexpected service: %#v", u.Service)
+	}
+
+	again, err := FromOptions(u.ToOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(again, u) {
+		t.Errorf("unit changed after ToOptions")
+		t.Logf("Expected: %#v", u)
+		t.Logf("Actual: %#v", again)
+	}
+}
+
+func TestFromOptionsInvalid(t *testing.T) {
+	tests := [][]*UnitOption{
+		{&UnitOption{"Service", "ExecStart", `/bin/echo "unterminated`}},
+		{&UnitOption{"Service", "Environment", "NOEQUALS"}},
+		{&UnitOption{"Service", "Environment", "=value"}},
+	}
+
+	for i, tt := range tests {
+		if _, err := FromOptions(tt); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unit
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ValidationWarning describes a section or directive of a unit file that
+// systemd does not know about, and would ignore.
+type ValidationWarning struct {
+	Line    int
+	Section string
+	Name    string // empty for warnings about a section header
+	Message string
+}
+
+func (w ValidationWarning) String() string {
+	return fmt.Sprintf("line %d: %s", w.Line, w.Message)
+}
+
+// Validate parses a systemd unit file like Deserialize does and checks every
+// section and directive name against the ones systemd accepts, returning a
+// warning for each unknown one. Names starting with "X-" are reserved for
+// third parties and never reported. Errors are only returned if the file
+// cannot be parsed at all.
+func Validate(f io.Reader) ([]ValidationWarning, error) {
+	file, err := DeserializeFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []ValidationWarning
+	line := 1
+	for _, e := range file.Elements {
+		if w, ok := validateElement(e); ok {
+			w.Line = line
+			warnings = append(warnings, w)
+		}
+		line += strings.Count(e.raw, "\n")
+	}
+
+	return warnings, nil
+}
+
+func validateElement(e *FileElement) (ValidationWarning, bool) {
+	w := ValidationWarning{Section: e.Section}
+
+	if isThirdParty(e.Section) {
+		return w, false
+	}
+
+	if e.Header {
+		if _, ok := knownDirectives[e.Section]; !ok {
+			w.Message = fmt.Sprintf("unknown section [%s]", e.Section)
+			return w, true
+		}
+		return w, false
+	}
+
+	if e.Option == nil {
+		return w, false
+	}
+
+	name := e.Option.Name
+	w.Name = name
+	directives, ok := knownDirectives[e.Section]
+	if !ok || isThirdParty(name) || directives[name] {
+		return w, false
+	}
+
+	if sections := sectionsOf(name); len(sections) > 0 {
+		w.Message = fmt.Sprintf("%s= is not valid in [%s], only in [%s]", name, e.Section, strings.Join(sections, "], ["))
+	} else {
+		w.Message = fmt.Sprintf("unknown directive %s= in [%s]", name, e.Section)
+	}
+	return w, true
+}
+
+func isThirdParty(name string) bool {
+	return strings.HasPrefix(name, "X-")
+}
+
+// sectionsOf returns the sections name is valid in.
+func sectionsOf(name string) []string {
+	var sections []string
+	for section, directives := range knownDirectives {
+		if directives[name] {
+			sections = append(sections, section)
+		}
+	}
+	sort.Strings(sections)
+	return sections
+}
+
+// knownDirectives maps each section to the directives valid in it, as
+// documented in systemd.unit(5) and the unit type specific man pages.
+var knownDirectives = map[string]map[string]bool{
+	"Unit":      directiveSet(unitDirectives, conditionDirectives()),
+	"Install":   directiveSet(installDirectives),
+	"Service":   directiveSet(serviceDirectives, execDirectives, killDirectives, resourceControlDirectives),
+	"Socket":    directiveSet(socketDirectives, execDirectives, killDirectives, resourceControlDirectives),
+	"Mount":     directiveSet(mountDirectives, execDirectives, killDirectives, resourceControlDirectives),
+	"Swap":      directiveSet(swapDirectives, execDirectives, killDirectives, resourceControlDirectives),
+	"Automount": directiveSet(automountDirectives),
+	"Path":      directiveSet(pathDirectives),
+	"Timer":     directiveSet(timerDirectives),
+	"Slice":     directiveSet(resourceControlDirectives),
+	"Scope":     directiveSet(scopeDirectives, killDirectives, resourceControlDirectives),
+}
+
+func directiveSet(lists ...string) map[string]bool {
+	set := make(map[string]bool)
+	for _, list := range lists {
+		for _, name := range strings.Fields(list) {
+			set[name] = true
+		}
+	}
+	return set
+}
+
+func conditionDirectives() string {
+	var names []string
+	for _, cond := range strings.Fields(conditions) {
+		names = append(names, "Condition"+cond, "Assert"+cond)
+	}
+	return strings.Join(names, " ")
+}
+
+const unitDirectives = `
+Description Documentation Requires Requisite Wants BindsTo PartOf Upholds
+Conflicts Before After OnFailure OnSuccess PropagatesReloadTo
+ReloadPropagatedFrom PropagatesStopTo StopPropagatedFrom JoinsNamespaceOf
+RequiresMountsFor WantsMountsFor OnFailureJobMode OnFailureIsolate
+IgnoreOnIsolate StopWhenUnneeded RefuseManualStart RefuseManualStop
+AllowIsolate DefaultDependencies SurviveFinalKillSignal CollectMode
+FailureAction SuccessAction FailureActionExitStatus SuccessActionExitStatus
+JobTimeoutSec JobRunningTimeoutSec JobTimeoutAction JobTimeoutRebootArgument
+StartLimitIntervalSec StartLimitInterval StartLimitBurst StartLimitAction
+RebootArgument SourcePath
+`
+
+const conditions = `
+Architecture Firmware Virtualization Host KernelCommandLine KernelVersion
+Credential Environment Security Capability ACPower NeedsUpdate FirstBoot
+PathExists PathExistsGlob PathIsDirectory PathIsSymbolicLink
+PathIsMountPoint PathIsReadWrite PathIsEncrypted DirectoryNotEmpty
+FileNotEmpty FileIsExecutable User Group ControlGroupController Memory CPUs
+CPUFeature OSRelease MemoryPressure CPUPressure IOPressure
+`
+
+const installDirectives = `
+Alias WantedBy RequiredBy UpheldBy Also DefaultInstance
+`
+
+const serviceDirectives = `
+Type ExitType RemainAfterExit GuessMainPID PIDFile BusName ExecStart
+ExecStartPre ExecStartPost ExecCondition ExecReload ExecStop ExecStopPost
+RestartSec RestartSteps RestartMaxDelaySec TimeoutStartSec TimeoutStopSec
+TimeoutAbortSec TimeoutSec TimeoutStartFailureMode TimeoutStopFailureMode
+RuntimeMaxSec RuntimeRandomizedExtraSec WatchdogSec Restart RestartMode
+SuccessExitStatus RestartPreventExitStatus RestartForceExitStatus
+RootDirectoryStartOnly PermissionsStartOnly NonBlocking NotifyAccess Sockets
+FileDescriptorStoreMax FileDescriptorStorePreserve USBFunctionDescriptors
+USBFunctionStrings OOMPolicy OpenFile ReloadSignal
+`
+
+const socketDirectives = `
+ListenStream ListenDatagram ListenSequentialPacket ListenFIFO ListenSpecial
+ListenNetlink ListenMessageQueue ListenUSBFunction SocketProtocol
+BindIPv6Only Backlog BindToDevice SocketUser SocketGroup SocketMode
+DirectoryMode Accept Writable FlushPending MaxConnections
+MaxConnectionsPerSource KeepAlive KeepAliveTimeSec KeepAliveIntervalSec
+KeepAliveProbes NoDelay Priority DeferAcceptSec ReceiveBuffer SendBuffer
+IPTOS IPTTL Mark ReusePort SmackLabel SmackLabelIPIn SmackLabelIPOut
+SELinuxContextFromNet PipeSize MessageQueueMaxMessages
+MessageQueueMessageSize FreeBind Transparent Broadcast PassCredentials
+PassSecurity PassPacketInfo Timestamping TCPCongestion ExecStartPre
+ExecStartPost ExecStopPre ExecStopPost TimeoutSec Service RemoveOnStop
+Symlinks FileDescriptorName TriggerLimitIntervalSec TriggerLimitBurst
+PollLimitIntervalSec PollLimitBurst
+`
+
+const mountDirectives = `
+What Where Type Options SloppyOptions LazyUnmount ReadWriteOnly ForceUnmount
+DirectoryMode TimeoutSec
+`
+
+const automountDirectives = `
+Where ExtraOptions DirectoryMode TimeoutIdleSec
+`
+
+const swapDirectives = `
+What Priority Options TimeoutSec
+`
+
+const pathDirectives = `
+PathExists PathExistsGlob PathChanged PathModified DirectoryNotEmpty Unit
+MakeDirectory DirectoryMode TriggerLimitIntervalSec TriggerLimitBurst
+`
+
+const timerDirectives = `
+OnActiveSec OnBootSec OnStartupSec OnUnitActiveSec OnUnitInactiveSec
+OnCalendar AccuracySec RandomizedDelaySec FixedRandomDelay OnClockChange
+OnTimezoneChange Unit Persistent WakeSystem RemainAfterElapse
+`
+
+const scopeDirectives = `
+RuntimeMaxSec RuntimeRandomizedExtraSec OOMPolicy
+`
+
+// execDirectives are documented in systemd.exec(5).
+const execDirectives = `
+WorkingDirectory RootDirectory RootImage RootImageOptions RootHash
+RootHashSignature RootVerity MountAPIVFS ProtectProc ProcSubset BindPaths
+BindReadOnlyPaths MountImages ExtensionImages ExtensionDirectories User Group
+DynamicUser SupplementaryGroups PAMName CapabilityBoundingSet
+AmbientCapabilities NoNewPrivileges SecureBits SELinuxContext
+AppArmorProfile SmackProcessLabel LimitCPU LimitFSIZE LimitDATA LimitSTACK
+LimitCORE LimitRSS LimitNOFILE LimitAS LimitNPROC LimitMEMLOCK LimitLOCKS
+LimitSIGPENDING LimitMSGQUEUE LimitNICE LimitRTPRIO LimitRTTIME UMask
+CoredumpFilter KeyringMode OOMScoreAdjust TimerSlackNSec Personality
+IgnoreSIGPIPE Nice CPUSchedulingPolicy CPUSchedulingPriority
+CPUSchedulingResetOnFork CPUAffinity NUMAPolicy NUMAMask IOSchedulingClass
+IOSchedulingPriority ProtectSystem ProtectHome RuntimeDirectory
+StateDirectory CacheDirectory LogsDirectory ConfigurationDirectory
+RuntimeDirectoryMode StateDirectoryMode CacheDirectoryMode LogsDirectoryMode
+ConfigurationDirectoryMode RuntimeDirectoryPreserve TimeoutCleanSec
+ReadWritePaths ReadOnlyPaths InaccessiblePaths ExecPaths NoExecPaths
+TemporaryFileSystem PrivateTmp PrivateDevices PrivateNetwork
+NetworkNamespacePath PrivateIPC IPCNamespacePath MemoryKSM PrivateUsers
+ProtectHostname ProtectClock ProtectKernelTunables ProtectKernelModules
+ProtectKernelLogs ProtectControlGroups RestrictAddressFamilies
+RestrictFileSystems RestrictNamespaces LockPersonality
+MemoryDenyWriteExecute RestrictRealtime RestrictSUIDSGID RemoveIPC
+PrivateMounts MountFlags SystemCallFilter SystemCallErrorNumber
+SystemCallArchitectures SystemCallLog Environment EnvironmentFile
+PassEnvironment UnsetEnvironment StandardInput StandardOutput StandardError
+StandardInputText StandardInputData LogLevelMax LogExtraFields
+LogRateLimitIntervalSec LogRateLimitBurst LogFilterPatterns LogNamespace
+SyslogIdentifier SyslogFacility SyslogLevel SyslogLevelPrefix TTYPath
+TTYReset TTYVHangup TTYRows TTYColumns TTYVTDisallocate LoadCredential
+LoadCredentialEncrypted ImportCredential SetCredential
+SetCredentialEncrypted UtmpIdentifier UtmpMode
+`
+
+// killDirectives are documented in systemd.kill(5).
+const killDirectives = `
+KillMode KillSignal RestartKillSignal SendSIGHUP SendSIGKILL FinalKillSignal
+WatchdogSignal
+`
+
+// resourceControlDirectives are documented in systemd.resource-control(5).
+const resourceControlDirectives = `
+CPUAccounting CPUWeight StartupCPUWeight CPUQuota CPUQuotaPeriodSec
+AllowedCPUs StartupAllowedCPUs AllowedMemoryNodes StartupAllowedMemoryNodes
+MemoryAccounting MemoryMin MemoryLow StartupMemoryLow
+DefaultStartupMemoryLow MemoryHigh StartupMemoryHigh MemoryMax
+StartupMemoryMax MemorySwapMax StartupMemorySwapMax MemoryZSwapMax
+StartupMemoryZSwapMax MemoryZSwapWriteback MemoryLimit TasksAccounting
+TasksMax IOAccounting IOWeight StartupIOWeight IODeviceWeight
+IOReadBandwidthMax IOWriteBandwidthMax IOReadIOPSMax IOWriteIOPSMax
+IODeviceLatencyTargetSec IPAccounting IPAddressAllow IPAddressDeny
+SocketBindAllow SocketBindDeny RestrictNetworkInterfaces NFTSet
+IPIngressFilterPath IPEgressFilterPath BPFProgram DeviceAllow DevicePolicy
+Slice Delegate DelegateSubgroup DisableControllers ManagedOOMSwap
+ManagedOOMMemoryPressure ManagedOOMMemoryPressureLimit ManagedOOMPreference
+MemoryPressureWatch MemoryPressureThresholdSec CoredumpReceive CPUShares
+StartupCPUShares BlockIOAccounting BlockIOWeight StartupBlockIOWeight
+BlockIODeviceWeight BlockIOReadBandwidth BlockIOWriteBandwidth
+`
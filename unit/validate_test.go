@@ -0,0 +1,98 @@
+// Copyright 2015 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package unit
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	input := `# a commented unit
+[Unit]
+Description=Foo
+ConditionPathExists=/etc/foo
+AssertUser=root
+X-Vendor=ok
+
+[Service]
+ExecStarts=/usr/bin/foo
+ExecStart=/usr/bin/foo \
+  --verbose
+LimitNOFILE=1024
+WantedBy=multi-user.target
+
+[Install]
+WantedBy=multi-user.target
+Restart=always
+
+[Sevice]
+Type=simple
+
+[X-Vendor]
+Anything=goes
+`
+
+	warnings, err := Validate(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expect := []ValidationWarning{
+		{9, "Service", "ExecStarts", "unknown directive ExecStarts= in [Service]"},
+		{13, "Service", "WantedBy", "WantedBy= is not valid in [Service], only in [Install]"},
+		{17, "Install", "Restart", "Restart= is not valid in [Install], only in [Service]"},
+		{19, "Sevice", "", "unknown section [Sevice]"},
+	}
+
+	if !reflect.DeepEqual(warnings, expect) {
+		t.Errorf("unexpected warnings")
+		for _, w := range warnings {
+			t.Logf("Actual: %v", w)
+		}
+	}
+
+	if s := warnings[0].String(); s != "line 9: unknown directive ExecStarts= in [Service]" {
+		t.Errorf("unexpected String(): %q", s)
+	}
+}
+
+func TestValidateClean(t *testing.T) {
+	input := `[Unit]
+Description=Clean timer
+
+[Timer]
+OnCalendar=daily
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`
+
+	warnings, err := Validate(bytes.NewBufferString(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+}
+
+func TestValidateParseError(t *testing.T) {
+	if _, err := Validate(bytes.NewBufferString("[Unit")); err == nil {
+		t.Errorf("expected error")
+	}
+}